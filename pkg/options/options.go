@@ -235,7 +235,7 @@ func (o *Options) SetOthersByFlags() {
 }
 
 func (o *Options) InitApplicationInfo(appInstance string, appGroup string) {
-	if tools.IsExist(tools.AppFile) && appInstance == DefaultApplicationInstance && appGroup == DefaultApplicationGroup {
+	if tools.IsExist(tools.GetAppFile()) && appInstance == DefaultApplicationInstance && appGroup == DefaultApplicationGroup {
 		// read from local file
 		instance, group, err := tools.ReadAppInfoFromFile()
 		if err != nil {
@@ -251,7 +251,7 @@ func (o *Options) InitApplicationInfo(appInstance string, appGroup string) {
 		return
 	}
 
-	if err := tools.RecordApplicationToFile(appInstance, appGroup, true); err != nil {
+	if _, err := tools.RecordApplicationToFile(appInstance, appGroup, true); err != nil {
 		logrus.WithError(err).Warningln("record application info to local file failed")
 	}
 }
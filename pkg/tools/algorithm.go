@@ -0,0 +1,73 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+const (
+	// AlgoVersion is bumped whenever the signing scheme described by AlgoSpec changes
+	AlgoVersion = 1
+
+	EncodingHexBase64 = "hex+base64"
+	EncodingBase64    = "base64"
+	EncodingHex       = "hex"
+	EncodingCustom    = "custom"
+
+	inputConcat = "signData || SK"
+	inputHMAC   = "HMAC(SK, signData)"
+)
+
+// AlgoSpec is a machine-readable description of the scheme of Sign, served to clients so that they
+// can configure themselves instead of following prose
+type AlgoSpec struct {
+	Version int    `json:"version"`
+	Hash    string `json:"hash"`
+	// Input is how the hashed bytes are built from the payload and the SK
+	Input string `json:"input"`
+	// Encoding is how the digest is encoded into the signature
+	Encoding       string `json:"encoding"`
+	BindsAccessKey bool   `json:"bindsAccessKey"`
+	BindsTimestamp bool   `json:"bindsTimestamp"`
+}
+
+// AlgorithmDescriptor describes the scheme of Sign under the current codec
+func AlgorithmDescriptor() AlgoSpec {
+	codec, _ := getSignatureCodec()
+	input := inputConcat
+	if hmacSigning.Load() {
+		input = inputHMAC
+	}
+	return AlgoSpec{
+		Version:        AlgoVersion,
+		Hash:           getHashSpec().name,
+		Input:          input,
+		Encoding:       codecEncoding(codec),
+		BindsAccessKey: false,
+		BindsTimestamp: false,
+	}
+}
+
+func codecEncoding(codec SignatureCodec) string {
+	switch codec.(type) {
+	case HexBase64Codec:
+		return EncodingHexBase64
+	case Base64Codec:
+		return EncodingBase64
+	case HexCodec:
+		return EncodingHex
+	default:
+		return EncodingCustom
+	}
+}
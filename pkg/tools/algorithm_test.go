@@ -0,0 +1,59 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+)
+
+// signPerDescriptor signs like a third-party client following the descriptor only
+func signPerDescriptor(t *testing.T, spec AlgoSpec, signData, secretKey string) string {
+	t.Helper()
+	if spec.Hash != "SHA-256" || spec.Input != "signData || SK" || spec.BindsAccessKey || spec.BindsTimestamp {
+		t.Fatalf("unsupported descriptor %+v", spec)
+	}
+	sum := sha256.Sum256([]byte(signData + secretKey))
+	switch spec.Encoding {
+	case EncodingHexBase64:
+		return base64.StdEncoding.EncodeToString([]byte(hex.EncodeToString(sum[:])))
+	case EncodingBase64:
+		return base64.StdEncoding.EncodeToString(sum[:])
+	case EncodingHex:
+		return hex.EncodeToString(sum[:])
+	}
+	t.Fatalf("unsupported encoding %s", spec.Encoding)
+	return ""
+}
+
+func TestAlgorithmDescriptorMatchesSign(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	defer SetSignatureCodec(HexBase64Codec{})
+	for _, codec := range []SignatureCodec{HexBase64Codec{}, Base64Codec{}, HexCodec{}} {
+		SetSignatureCodec(codec)
+		spec := AlgorithmDescriptor()
+		if spec.Version != AlgoVersion {
+			t.Errorf("expected version %d, got %d", AlgoVersion, spec.Version)
+		}
+		sign := signPerDescriptor(t, spec, "data", "sk")
+		if sign != Sign("data") || !Auth(sign, "data") {
+			t.Errorf("expected the signature per %+v to match Sign", spec)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var ErrAKNotAllowed = errors.New("access key not allowed")
+
+// akAllowlist is the set of AKs accepted by VerifyFor until the time it expires
+type akAllowlist struct {
+	aks   map[string]bool
+	until time.Time
+}
+
+// activeAKAllowlist holds the *akAllowlist in force, nil if none
+var activeAKAllowlist atomic.Pointer[akAllowlist]
+
+// SetAKAllowlist is a containment control for incidents: until the given time, VerifyFor and VerifyAuthHeader
+// reject the AKs outside of aks with ErrAKNotAllowed, whatever their signature. An empty aks rejects every AK,
+// a zero until removes the allowlist.
+func SetAKAllowlist(aks []string, until time.Time) {
+	if until.IsZero() {
+		activeAKAllowlist.Store(nil)
+		return
+	}
+	allowlist := &akAllowlist{aks: make(map[string]bool, len(aks)), until: until}
+	for _, ak := range aks {
+		allowlist.aks[ak] = true
+	}
+	activeAKAllowlist.Store(allowlist)
+}
+
+// checkAKAllowed returns ErrAKNotAllowed if an allowlist is in force and ak isn't in it
+func checkAKAllowed(ak string) error {
+	allowlist := activeAKAllowlist.Load()
+	if allowlist == nil || !timeNow().Before(allowlist.until) || allowlist.aks[ak] {
+		return nil
+	}
+	return fmt.Errorf("%w: %s until %s", ErrAKNotAllowed, ak, allowlist.until.Format(time.RFC3339))
+}
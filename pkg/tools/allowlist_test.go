@@ -0,0 +1,80 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAKAllowlist(t *testing.T) {
+	t.Cleanup(func() { SetAKAllowlist(nil, time.Time{}) })
+	lookup := lookupTestKeys(map[string]string{"agent1": "sk1", "agent2": "sk2"})
+	sign1 := signWithKey("data", "sk1", HexBase64Codec{})
+	sign2 := signWithKey("data", "sk2", HexBase64Codec{})
+	SetAKAllowlist([]string{"agent1"}, time.Now().Add(time.Minute))
+
+	if ok, err := VerifyFor("agent1", sign1, "data", lookup); !ok || err != nil {
+		t.Errorf("expected an allowed AK to verify, got %v, %v", ok, err)
+	}
+	if ok, err := VerifyFor("agent2", sign2, "data", lookup); ok || !errors.Is(err, ErrAKNotAllowed) {
+		t.Errorf("expected ErrAKNotAllowed for a valid signature of another AK, got %v, %v", ok, err)
+	}
+
+	setTestKeys(t, "agent2", "sk2")
+	header, err := BuildAuthHeader("data", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	owners := lookupTestOwners(map[string]Credentials{
+		"agent1": {AccessKey: "agent1", SecretKey: "sk1"},
+		"agent2": {AccessKey: "agent2", SecretKey: "sk2"},
+		"kid2":   {AccessKey: "agent2", SecretKey: "sk2"},
+	})
+	if ok, err := VerifyAuthHeader(header, "data", owners); ok || !errors.Is(err, ErrAKNotAllowed) {
+		t.Errorf("expected the header of a disallowed AK to be rejected, got %v, %v", ok, err)
+	}
+	// the kid of a disallowed AK can't be presented under an allowed AK
+	spoofed := AuthHeader{AccessKey: "agent1", KeyID: "kid2", Signature: sign2}.String()
+	if ok, err := VerifyAuthHeader(spoofed, "data", owners); ok || !errors.Is(err, ErrKeyOwnerMismatch) {
+		t.Errorf("expected a kid claimed by another AK to be rejected, got %v, %v", ok, err)
+	}
+
+	// the allowlist expires by itself
+	setTestNow(t, 2*time.Minute)
+	if ok, err := VerifyFor("agent2", sign2, "data", lookup); !ok || err != nil {
+		t.Errorf("expected every AK to verify after expiry, got %v, %v", ok, err)
+	}
+	if ok, err := VerifyAuthHeader(header, "data", owners); !ok || err != nil {
+		t.Errorf("expected the header to verify after expiry, got %v, %v", ok, err)
+	}
+}
+
+func TestAKAllowlistRemoved(t *testing.T) {
+	t.Cleanup(func() { SetAKAllowlist(nil, time.Time{}) })
+	lookup := lookupTestKeys(map[string]string{"agent1": "sk1"})
+	sign := signWithKey("data", "sk1", HexBase64Codec{})
+	SetAKAllowlist(nil, time.Now().Add(time.Minute))
+	if _, err := VerifyFor("agent1", sign, "data", lookup); !errors.Is(err, ErrAKNotAllowed) {
+		t.Errorf("expected an empty allowlist to reject every AK, got %v", err)
+	}
+	SetAKAllowlist(nil, time.Time{})
+	if ok, err := VerifyFor("agent1", sign, "data", lookup); !ok || err != nil {
+		t.Errorf("expected the removed allowlist to accept the AK, got %v, %v", ok, err)
+	}
+}
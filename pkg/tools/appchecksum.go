@@ -0,0 +1,67 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync/atomic"
+)
+
+// ChecksumKeyName is the key of the trailing line of the app file holding an HMAC over the other lines
+const ChecksumKeyName = "checksum"
+
+var (
+	ErrAppFileTampered = errors.New("app file tampered")
+
+	skipAppFileVerification atomic.Bool
+)
+
+// SetAppFileVerification enables or disables the verification of the app file checksum by
+// ReadAppInfoFromFile, it's enabled by default. An app file without checksum, written before
+// it was introduced, is always accepted.
+func SetAppFileVerification(enabled bool) {
+	skipAppFileVerification.Store(!enabled)
+}
+
+// appFileChecksum returns the HMAC of the host over the sorted lines of data except the checksum,
+// so that a manual edit or a file copied from another host is detected
+func appFileChecksum(data map[string]string) string {
+	lines := make(map[string]string, len(data))
+	for key, value := range data {
+		if key != ChecksumKeyName {
+			lines[key] = value
+		}
+	}
+	h := hmac.New(sha256.New, hostSecret())
+	h.Write(encodeMap(lines))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// verifyAppFileChecksum checks the checksum of the app file content if it has one
+func verifyAppFileChecksum(data map[string]string) error {
+	checksum, ok := data[ChecksumKeyName]
+	if !ok || skipAppFileVerification.Load() {
+		return nil
+	}
+	if !hmac.Equal([]byte(checksum), []byte(appFileChecksum(data))) {
+		return ErrAppFileTampered
+	}
+	return nil
+}
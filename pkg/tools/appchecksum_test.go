@@ -0,0 +1,86 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestAppFileChecksum(t *testing.T) {
+	appFile, _ := setTestFiles(t)
+	if _, err := RecordApplicationToFile("instance", "groupA", true); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(appFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if !strings.HasPrefix(lines[len(lines)-1], ChecksumKeyName+Delimiter) {
+		t.Errorf("expected a trailing checksum line, got %q", content)
+	}
+	if _, appGroup, err := ReadAppInfoFromFile(); err != nil || appGroup != "groupA" {
+		t.Errorf("expected a valid checksum, got %q, %v", appGroup, err)
+	}
+
+	if err := RecordRegistrationState(RegistrationRegistered, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RecordApplicationToFile("instance", "groupB", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, appGroup, err := ReadAppInfoFromFile(); err != nil || appGroup != "groupB" {
+		t.Errorf("expected merges to keep the checksum valid, got %q, %v", appGroup, err)
+	}
+}
+
+func TestAppFileTampered(t *testing.T) {
+	appFile, _ := setTestFiles(t)
+	if _, err := RecordApplicationToFile("instance", "groupA", true); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(appFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(content), "groupA", "groupB", 1)
+	if err := ioutil.WriteFile(appFile, []byte(tampered), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ReadAppInfoFromFile(); !errors.Is(err, ErrAppFileTampered) {
+		t.Errorf("expected ErrAppFileTampered, got %v", err)
+	}
+
+	SetAppFileVerification(false)
+	defer SetAppFileVerification(true)
+	if _, appGroup, err := ReadAppInfoFromFile(); err != nil || appGroup != "groupB" {
+		t.Errorf("expected the verification to be disabled, got %q, %v", appGroup, err)
+	}
+}
+
+func TestAppFileWithoutChecksum(t *testing.T) {
+	appFile, _ := setTestFiles(t)
+	if err := ioutil.WriteFile(appFile, []byte("appInstance=instance\nappGroup=group\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, appGroup, err := ReadAppInfoFromFile(); err != nil || appGroup != "group" {
+		t.Errorf("expected a legacy app file to be accepted, got %q, %v", appGroup, err)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// appFileBackupSuffix is appended to the app file name for the backup made by ResetAppFile
+const appFileBackupSuffix = ".bak"
+
+// ResetAppFile recovers an agent stuck on a corrupt app file, e.g. ErrAppFileTampered: the file is backed up
+// to .chaos.app.bak beside it for investigation, a previous backup is replaced, then the app file is replaced
+// by an empty one, so that the agent registers again. Nothing is backed up if there is no app file.
+func ResetAppFile() error {
+	if skip, err := skipPersistence(); skip {
+		return err
+	}
+	appFile := GetAppFile()
+	mutex.Lock()
+	defer mutex.Unlock()
+	content, err := os.ReadFile(appFile)
+	switch {
+	case err == nil:
+		if err := replaceFile(appFile+appFileBackupSuffix, content, 0o600); err != nil {
+			return err
+		}
+		log.Warnf("app file %s reset, the previous one is backed up to %s", appFile, appFile+appFileBackupSuffix)
+	case !os.IsNotExist(err):
+		return err
+	}
+	return replaceFile(appFile, nil, 0o666)
+}
+
+// replaceFile atomically replaces filePath with content, the caller holds the mutex
+func replaceFile(filePath string, content []byte, perm os.FileMode) error {
+	temp, err := writeTempFile(filePath, content, perm)
+	if err != nil {
+		return err
+	}
+	if err := rename(temp, filePath); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return nil
+}
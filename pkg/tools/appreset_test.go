@@ -0,0 +1,71 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestResetAppFile(t *testing.T) {
+	appFile, _ := setTestFiles(t)
+	if _, err := RecordApplicationToFile("instance", "group", true); err != nil {
+		t.Fatal(err)
+	}
+	corrupt, err := os.ReadFile(appFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt = []byte(strings.Replace(string(corrupt), "group", "other", 1))
+	if err := os.WriteFile(appFile, corrupt, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ReadAppInfoFromFile(); !errors.Is(err, ErrAppFileTampered) {
+		t.Fatalf("expected a tampered app file, got %v", err)
+	}
+
+	if err := ResetAppFile(); err != nil {
+		t.Fatal(err)
+	}
+	if backup, err := os.ReadFile(appFile + ".bak"); err != nil || string(backup) != string(corrupt) {
+		t.Errorf("expected the corrupt file to be backed up, got %q, %v", backup, err)
+	}
+	if instance, group, err := ReadAppInfoFromFile(); err != nil || instance != "" || group != "" {
+		t.Errorf("expected a fresh empty app file, got %q, %q, %v", instance, group, err)
+	}
+	if _, err := RecordApplicationToFile("instance", "group", true); err != nil {
+		t.Fatal(err)
+	}
+	if instance, _, err := ReadAppInfoFromFile(); err != nil || instance != "instance" {
+		t.Errorf("expected the agent to register again, got %q, %v", instance, err)
+	}
+}
+
+func TestResetAppFileMissing(t *testing.T) {
+	appFile, _ := setTestFiles(t)
+	if err := ResetAppFile(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(appFile + ".bak"); !os.IsNotExist(err) {
+		t.Errorf("expected no backup without app file, got %v", err)
+	}
+	if _, err := os.Stat(appFile); err != nil {
+		t.Errorf("expected a fresh app file, got %v", err)
+	}
+}
@@ -17,15 +17,23 @@
 package tools
 
 import (
+	"bufio"
+	"context"
+	"crypto/hmac"
 	"crypto/sha256"
-	"encoding/base64"
+	"encoding/base32"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
 	"path"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -37,140 +45,798 @@ const (
 
 	AppInstanceKeyName = "appInstance"
 	AppGroupKeyName    = "appGroup"
+
+	// MaxLineLength bounds the lines parsed from the app file and the cert file
+	MaxLineLength = 64 * 1024
+
+	// AppPathEnv and CertPathEnv override the default location of the app file and the cert file
+	AppPathEnv  = "CHAOS_APP_PATH"
+	CertPathEnv = "CHAOS_CERT_PATH"
+
+	// trimmedCutset is the trailing whitespace ignored by SignTrimmed and AuthTrimmed
+	trimmedCutset = " \t\r\n"
 )
 
 var (
-	AppFile        = path.Join(GetCurrentDirectory(), ".chaos.app")
-	localAccessKey = ""
-	localSecureKey = ""
-	mutex          = sync.RWMutex{}
+	appFile  = ""
+	certFile = ""
+	mutex    = sync.RWMutex{}
+
+	signatureCodec     = SignatureCodec(HexBase64Codec{})
+	legacySignFallback = false
+
+	// secondarySecureKeys are still accepted by Auth during a key rotation window
+	secondarySecureKeys []string
+
+	// maxSignDataLength bounds the signData hashed when verifying, 0 means unlimited
+	maxSignDataLength = 0
+
+	ErrSignDataTooLarge     = errors.New("signData too large")
+	ErrCredentialDirMissing = errors.New("credential directory doesn't exist")
+	ErrHomeDirUnavailable   = errors.New("user home directory unavailable")
+	ErrAppGroupNotAllowed   = errors.New("appGroup not allowed")
+	ErrSignMismatch         = errors.New("sign not equal")
+	ErrMalformedSignature   = errors.New("malformed signature")
 )
 
-// GetAccessKey
-func GetAccessKey() string {
+// SetMaxSignDataLength limits the length of signData accepted by the verifiers, so that oversized
+// input is rejected before hashing. 0 disables the limit.
+func SetMaxSignDataLength(length int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	maxSignDataLength = length
+}
+
+func checkSignDataLength(length int) error {
 	mutex.RLock()
 	defer mutex.RUnlock()
-	return localAccessKey
+	if maxSignDataLength > 0 && length > maxSignDataLength {
+		return fmt.Errorf("%w: %d > %d", ErrSignDataTooLarge, length, maxSignDataLength)
+	}
+	return nil
+}
+
+// SetSecondarySecretKeys sets the secret keys accepted by Auth besides the primary one
+func SetSecondarySecretKeys(secretKeys ...string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	secondarySecureKeys = append([]string(nil), secretKeys...)
+	authVerifyCache.purge()
+}
+
+func getSecondarySecretKeys() []string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return secondarySecureKeys
+}
+
+// KeyFingerprint returns a short identifier of the secret key which doesn't reveal the key
+func KeyFingerprint(secretKey string) string {
+	sum256 := sha256.Sum256([]byte(secretKey))
+	return hex.EncodeToString(sum256[:8])
+}
+
+// AgentDisplayID returns a short identifier of the agent for UIs, derived from the in-memory AK only:
+// the first 80 bits of its sha256 in lowercase base32, 16 characters. It's empty without AK.
+func AgentDisplayID() string {
+	accessKey := GetAccessKey()
+	if accessKey == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(accessKey))
+	return strings.ToLower(base32.StdEncoding.EncodeToString(sum[:10]))
+}
+
+// SetSignFormat sets the format used by Sign and expected by Auth
+func SetSignFormat(format SignFormat) {
+	SetSignatureCodec(format.codec())
+}
+
+// SetSignatureCodec sets the codec used by Sign to encode the digest and by Auth to decode
+// the received signature, nil restores the default HexBase64Codec
+func SetSignatureCodec(codec SignatureCodec) {
+	if codec == nil {
+		codec = HexBase64Codec{}
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	signatureCodec = codec
+	authVerifyCache.purge()
+}
+
+// SetLegacySignFallback enables Auth to accept the legacy HexBase64Codec format when the
+// signature doesn't match the configured codec, used during the migration window.
+func SetLegacySignFallback(enabled bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	legacySignFallback = enabled
+	authVerifyCache.purge()
+}
+
+// SignatureLength returns the length of the signatures produced by Sign with the configured codec and hash,
+// with SHA-256: 88 for HexBase64Codec (base64 of the 64 hex chars) and 44 for Base64Codec (base64 of 32 bytes).
+func SignatureLength() int {
+	codec, _ := getSignatureCodec()
+	return len(codec.Encode(make([]byte, getHashSpec().size)))
+}
+
+func getSignatureCodec() (SignatureCodec, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return signatureCodec, legacySignFallback
+}
+
+// getSigningState returns the SK with the codec to sign or verify with
+func getSigningState() (secretKey string, codec SignatureCodec, fallback bool) {
+	codec, fallback = getSignatureCodec()
+	return defaultManager.SecretKey(), codec, fallback
+}
+
+// GetAppFile returns the path of the application record file. The path set by SetAppFile takes
+// precedence over the CHAOS_APP_PATH environment variable, which takes precedence over
+// .chaos.app in the process directory.
+func GetAppFile() string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if appFile != "" {
+		return appFile
+	}
+	if filePath := os.Getenv(AppPathEnv); filePath != "" {
+		return filePath
+	}
+	return path.Join(GetCurrentDirectory(), ".chaos.app")
+}
+
+// SetAppFile changes the path of the application record file, empty restores the default
+func SetAppFile(filePath string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	appFile = filePath
+}
+
+// GetCertFile returns the path of the AK/SK record file. The path set by SetCertFile takes
+// precedence over the CHAOS_CERT_PATH environment variable, which takes precedence over
+// .chaos.cert in the user home.
+func GetCertFile() string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if certFile != "" {
+		return certFile
+	}
+	if filePath := os.Getenv(CertPathEnv); filePath != "" {
+		return filePath
+	}
+	return path.Join(userHome(), ".chaos.cert")
+}
+
+// userHome is GetUserHome, replaced in tests
+var userHome = GetUserHome
+
+// resolveCertFile returns GetCertFile, or ErrHomeDirUnavailable if it defaults to the user home and
+// the home is unknown, because the default path would then silently be relative to the working directory
+func resolveCertFile() (string, error) {
+	mutex.RLock()
+	explicit := certFile
+	mutex.RUnlock()
+	if explicit == "" && os.Getenv(CertPathEnv) == "" && userHome() == "" {
+		return "", fmt.Errorf("%w, set %s or the cert file path", ErrHomeDirUnavailable, CertPathEnv)
+	}
+	return GetCertFile(), nil
+}
+
+// SetCertFile changes the path of the AK/SK record file, empty restores the default
+func SetCertFile(filePath string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	certFile = filePath
+}
+
+// OnCredentialsLoaded registers a callback invoked with the AK whenever the in-memory keys
+// become available or are rotated
+func OnCredentialsLoaded(callback func(ak string)) {
+	defaultManager.OnLoaded(callback)
+}
+
+// setCredentials replaces the in-memory keys and notifies the OnCredentialsLoaded callbacks if they changed,
+// ErrWeakSecret is returned for an SK weaker than SetMinSecretStrength
+func setCredentials(accessKey, secretKey string) error {
+	return defaultManager.Set(accessKey, secretKey)
+}
+
+// GetAccessKey
+func GetAccessKey() string {
+	return defaultManager.AccessKey()
 }
 
 // GetSecureKey
 func GetSecureKey() string {
+	return defaultManager.SecretKey()
+}
+
+// LatencyObserver receives the time spent hashing and encoding in Sign and Auth,
+// so that a histogram can be wired in without importing a metrics library here.
+type LatencyObserver interface {
+	ObserveSign(d time.Duration)
+	ObserveAuth(d time.Duration)
+}
+
+type noopLatencyObserver struct{}
+
+func (noopLatencyObserver) ObserveSign(time.Duration) {}
+func (noopLatencyObserver) ObserveAuth(time.Duration) {}
+
+var latencyObserver LatencyObserver = noopLatencyObserver{}
+
+// SetLatencyObserver sets the observer called by Sign and Auth, nil restores the no-op one
+func SetLatencyObserver(observer LatencyObserver) {
+	if observer == nil {
+		observer = noopLatencyObserver{}
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	latencyObserver = observer
+}
+
+func getLatencyObserver() LatencyObserver {
 	mutex.RLock()
 	defer mutex.RUnlock()
-	return localSecureKey
+	return latencyObserver
+}
+
+// SigningString returns the canonical string signed by Sign, the bytes hashed are this string
+// immediately followed by the SK, or its HMAC keyed by the SK with SetHMACSigning. It's exposed so that
+// other implementations can mirror Sign exactly.
+func SigningString(signData string) string {
+	return signData
 }
 
-// Sign
-func Sign(signData string) string {
-	sum256 := sha256.Sum256([]byte((signData + localSecureKey)))
-	encodeToString := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%x", string(sum256[:]))))
-	return encodeToString
+func signingBytes(signData, secretKey string) []byte {
+	return []byte(SigningString(signData) + secretKey)
 }
 
-func splitToChunk(encodeString string, size int) string {
-	if len(encodeString) < size {
-		return encodeString
+func digest(signData, secretKey string) []byte {
+	spec, useHMAC := getHashSpec(), hmacSigning.Load()
+	if spec == sha256Spec && !useHMAC {
+		sum256 := sha256.Sum256(signingBytes(signData, secretKey))
+		return sum256[:]
 	}
-	temp := make([]string, 0, len(encodeString)/size+1)
-	for len(encodeString) > 0 {
-		if len(encodeString) < size {
-			size = len(encodeString)
-		}
-		temp, encodeString = append(temp, encodeString[:size]), encodeString[size:]
+	return digestWith(spec, useHMAC, signData, secretKey)
+}
+
+// digestWith is digest with the hash spec and HMAC signing given rather than configured
+func digestWith(spec *hashSpec, useHMAC bool, signData, secretKey string) []byte {
+	if useHMAC {
+		mac := hmac.New(spec.newHash, []byte(secretKey))
+		mac.Write([]byte(SigningString(signData)))
+		return mac.Sum(nil)
 	}
-	return strings.Join(temp, "")
+	h := spec.newHash()
+	h.Write(signingBytes(signData, secretKey))
+	return h.Sum(nil)
 }
 
-func Auth(sign, signData string) bool {
-	expectSign := Sign(signData)
-	if expectSign != sign {
-		log.Warningf("Sign not equal. ak: %s, expectSign: %s, receiveSign: %s", GetAccessKey(), expectSign, sign)
+// digestBytes is digest for a payload held in bytes, SigningString of bytes is the bytes themselves
+func digestBytes(data []byte, secretKey string) []byte {
+	if hmacSigning.Load() {
+		return hmacDigest(data, secretKey)
+	}
+	h := getHashSpec().newHash()
+	h.Write(data)
+	h.Write([]byte(secretKey))
+	return h.Sum(nil)
+}
+
+func signWithKey(signData, secretKey string, codec SignatureCodec) string {
+	return codec.Encode(digest(signData, secretKey))
+}
+
+func verifyWithKey(signature, signData, secretKey string, codec SignatureCodec) bool {
+	return verifyDigest(signature, digest(signData, secretKey), codec)
+}
+
+// verifyDigest decodes the signature with codec and compares it with the expected digest in constant time
+func verifyDigest(signature string, expected []byte, codec SignatureCodec) bool {
+	received, err := codec.Decode(signature)
+	if err != nil {
 		return false
 	}
-	return true
+	return hmac.Equal(received, expected)
+}
+
+// WrapBase64 inserts sep every width characters of s, like the line wrapping of PEM files
+func WrapBase64(s string, width int, sep string) string {
+	if width <= 0 || len(s) <= width {
+		return s
+	}
+	temp := make([]string, 0, len(s)/width+1)
+	for len(s) > 0 {
+		size := width
+		if len(s) < size {
+			size = len(s)
+		}
+		temp, s = append(temp, s[:size]), s[size:]
+	}
+	return strings.Join(temp, sep)
+}
+
+// UnwrapBase64 removes the separators inserted by WrapBase64
+func UnwrapBase64(s string, sep string) string {
+	if sep == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, sep, "")
 }
 
-// Record AK/SK to file
+// Auth verifies a signature produced by Sign, see Sign for the signData it must not accept
+func Auth(signature, signData string) bool {
+	return AuthErr(signature, signData) == nil
+}
+
+// AuthErr is Auth telling why the verification failed: ErrSignDataTooLarge, ErrMalformedSignature when
+// the signature can't be decoded by the configured codec, or ErrSignMismatch. A middleware can answer
+// a malformed signature with 400 and a mismatch with 401.
+func AuthErr(signature, signData string) error {
+	return authenticate(signature, len(signData), func(secretKey string) []byte {
+		return digest(signData, secretKey)
+	}, func(secretKey string) []byte {
+		return legacySHA1Digest([]byte(signData), secretKey)
+	}, func() [sha256.Size]byte {
+		return verifyCacheKey(signature, []byte(signData))
+	})
+}
+
+// AuthTrimmed verifies a signature from SignTrimmed, the trailing whitespace of signData is ignored
+func AuthTrimmed(signature, signData string) bool {
+	return Auth(signature, strings.TrimRight(signData, trimmedCutset))
+}
+
+// AuthBytes is Auth for a payload received as bytes, it saves converting the payload to a string
+func AuthBytes(signature string, data []byte) bool {
+	return authenticate(signature, len(data), func(secretKey string) []byte {
+		return digestBytes(data, secretKey)
+	}, func(secretKey string) []byte {
+		return legacySHA1Digest(data, secretKey)
+	}, func() [sha256.Size]byte {
+		return verifyCacheKey(signature, data)
+	}) == nil
+}
+
+// authenticate verifies the signature of a payload of length whose digest under a key is computed by digestOf,
+// and by legacyDigestOf for the SHA-1 signatures of old agents
+func authenticate(signature string, length int, digestOf, legacyDigestOf func(secretKey string) []byte, cacheKeyOf func() [sha256.Size]byte) error {
+	err := authenticateSignature(signature, length, digestOf, legacyDigestOf, cacheKeyOf)
+	authCounters.countAuth(err == nil)
+	return err
+}
+
+func authenticateSignature(signature string, length int, digestOf, legacyDigestOf func(secretKey string) []byte, cacheKeyOf func() [sha256.Size]byte) error {
+	if credentialsDisabled.Load() {
+		return ErrCredentialsDisabled
+	}
+	if err := checkSignDataLength(length); err != nil {
+		ak := GetAccessKey()
+		recordAuthEvent(ak, "sign data rejected: "+err.Error())
+		if ok, suppressed := authFailureLogLimiter.allow(ak); ok {
+			log.WithError(err).Warningf("Sign data rejected. ak: %s, suppressed: %d", ak, suppressed)
+		}
+		return err
+	}
+	start := time.Now()
+	var cacheKey [sha256.Size]byte
+	cacheEnabled := authVerifyCache.enabled()
+	if cacheEnabled {
+		cacheKey = cacheKeyOf()
+		if authVerifyCache.contains(cacheKey) {
+			getLatencyObserver().ObserveAuth(time.Since(start))
+			return nil
+		}
+	}
+	secretKey, codec, fallback := getSigningState()
+	legacySHA1 := legacySHA1Verification.Load()
+	if !decodable(signature, codec, fallback || legacySHA1) {
+		getLatencyObserver().ObserveAuth(time.Since(start))
+		ak := GetAccessKey()
+		recordAuthEvent(ak, "malformed signature")
+		if ok, suppressed := authFailureLogLimiter.allow(ak); ok {
+			log.Warningf("Sign malformed. ak: %s, receiveSign: %s, suppressed: %d", ak, signature, suppressed)
+		}
+		return ErrMalformedSignature
+	}
+	expected := digestOf(secretKey)
+	matched := verifyDigest(signature, expected, codec)
+	if !matched {
+		for _, secondaryKey := range getSecondarySecretKeys() {
+			if verifyDigest(signature, digestOf(secondaryKey), codec) {
+				matched = true
+				break
+			}
+		}
+	}
+	legacyMatched := false
+	if _, isLegacy := codec.(HexBase64Codec); !matched && fallback && !isLegacy {
+		legacyMatched = verifyDigest(signature, expected, HexBase64Codec{})
+	}
+	sha1Matched := !matched && !legacyMatched && legacySHA1 &&
+		verifyDigest(signature, legacyDigestOf(secretKey), HexBase64Codec{})
+	getLatencyObserver().ObserveAuth(time.Since(start))
+	if legacyMatched {
+		ak := GetAccessKey()
+		recordAuthEvent(ak, "deprecated sign format accepted")
+		log.Warningf("Deprecated sign format accepted. ak: %s", ak)
+		return nil
+	}
+	if sha1Matched {
+		ak := GetAccessKey()
+		recordAuthEvent(ak, "legacy SHA-1 sign accepted")
+		log.Warningf("Legacy SHA-1 sign accepted, please upgrade the agent. ak: %s", ak)
+		return nil
+	}
+	if !matched {
+		ak := GetAccessKey()
+		recordAuthEvent(ak, "sign not equal")
+		if ok, suppressed := authFailureLogLimiter.allow(ak); ok {
+			log.Warningf("Sign not equal. ak: %s, expectSign: %s, receiveSign: %s, suppressed: %d",
+				ak, codec.Encode(expected), signature, suppressed)
+		}
+		return ErrSignMismatch
+	}
+	if cacheEnabled {
+		authVerifyCache.add(cacheKey)
+		enforceCacheMemoryLimit()
+	}
+	return nil
+}
+
+// decodable returns whether the signature can be decoded by codec, or by the legacy codec if the fallback is enabled
+func decodable(signature string, codec SignatureCodec, fallback bool) bool {
+	if _, err := codec.Decode(signature); err == nil {
+		return true
+	}
+	if _, isLegacy := codec.(HexBase64Codec); fallback && !isLegacy {
+		_, err := HexBase64Codec{}.Decode(signature)
+		return err == nil
+	}
+	return false
+}
+
+// Record AK/SK to file, ErrCredentialDirMissing is returned if the directory of the cert file doesn't exist
 func RecordSecretKeyToFile(accessKey, secretKey string) error {
-	if accessKey == "" || secretKey == "" {
-		log.Warningln("key: ", accessKey, secretKey)
-		return errors.New("accessKey or secretKey is empty")
+	return recordSecretKeyToFile(accessKey, secretKey, false)
+}
+
+// RecordSecretKeyToFileMkdir records AK/SK to file, creating the directory of the cert file if it doesn't exist
+func RecordSecretKeyToFileMkdir(accessKey, secretKey string) error {
+	return recordSecretKeyToFile(accessKey, secretKey, true)
+}
+
+func recordSecretKeyToFile(accessKey, secretKey string, createDir bool) error {
+	if err := checkSecretStrength(secretKey); err != nil {
+		return err
+	}
+	if skip, err := skipPersistence(); skip {
+		setCredentials(accessKey, secretKey)
+		return err
+	}
+	keys := certFileKeys(Credentials{AccessKey: accessKey, SecretKey: secretKey})
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return err
+	}
+	if err := ensureCredentialDir(certFile, createDir); err != nil {
+		return err
+	}
+	write := writeCredentialFile
+	if certFileVersions.Load() > 0 {
+		write = writeVersionedCertFile
 	}
+	if err := write(keys, certFile); err != nil {
+		return err
+	}
+	recordCertFileState(certFile)
+	return setCredentialsFrom(certFileSource(certFile, certFormatText), accessKey, secretKey)
+}
 
+// certFileKeys returns the keys of the cert file recording creds. The expiry and the policy of the
+// in-memory keys are kept if creds are the in-memory keys, as they're reset when the keys change.
+func certFileKeys(creds Credentials) map[string]string {
 	keys := map[string]string{
-		AccessKeyName: accessKey,
-		SecretKeyName: secretKey,
+		AccessKeyName: creds.AccessKey,
+		SecretKeyName: creds.SecretKey,
 	}
-	err := RecordMapToFile(keys, path.Join(GetUserHome(), ".chaos.cert"), true)
-	if err != nil {
+	if !CredentialsEqual(creds, defaultManager.Credentials()) {
+		return keys
+	}
+	if expiry := CredentialExpiry(); !expiry.IsZero() {
+		keys[ExpiryKeyName] = expiry.UTC().Format(time.RFC3339)
+	}
+	return withKeyPolicy(keys)
+}
+
+// writeCredentialFile writes AK/SK to certFile readable by the owner only. An existing file is restricted
+// before it's truncated, so that the keys are never readable by others, even with looser permissions.
+// The private key of the file is kept unless keys replace it.
+func writeCredentialFile(keys map[string]string, certFile string) error {
+	if err := checkRequiredKeys(keys, certFile, []string{AccessKeyName, SecretKeyName}); err != nil {
 		return err
 	}
-	localAccessKey = accessKey
-	localSecureKey = secretKey
-	return nil
+	mutex.Lock()
+	defer mutex.Unlock()
+	keys = keepPrivateKey(keys, certFile)
+	return writeMapToFile(keys, certFile, true, 0o600)
+}
+
+// ensureCredentialDir checks the directory of filePath exists, creating it if createDir is true
+func ensureCredentialDir(filePath string, createDir bool) error {
+	dir := filepath.Dir(filePath)
+	if _, err := os.Stat(dir); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+	if !createDir {
+		return fmt.Errorf("%w: %s", ErrCredentialDirMissing, dir)
+	}
+	return os.MkdirAll(dir, 0o700)
 }
 
-// RecordApplicationToFile
-func RecordApplicationToFile(appInstance, appGroup string, truncate bool) error {
+// RecordApplicationToFile records the application info to the app file, replacing the file when truncate is set
+// or merging into it otherwise. The returned ChangeSet describes how the recorded keys changed.
+func RecordApplicationToFile(appInstance, appGroup string, truncate bool) (ChangeSet, error) {
 	keys := map[string]string{
 		AppInstanceKeyName: appInstance,
 		AppGroupKeyName:    appGroup,
 	}
-	return RecordMapToFile(keys, AppFile, truncate)
+	if skip, err := skipPersistence(); skip {
+		return ChangeSet{}, err
+	}
+	filePath := GetAppFile()
+	if !truncate {
+		return mergeMapToFile(keys, filePath, nil, true)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	previous, err := readMapFromFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return ChangeSet{}, err
+	}
+	content := map[string]string{ChecksumKeyName: appFileChecksum(keys)}
+	for key, value := range keys {
+		content[key] = value
+	}
+	if err := writeMapToFile(content, filePath, true, 0o666); err != nil {
+		return ChangeSet{}, err
+	}
+	return diffMaps(previous, keys, true), nil
+}
+
+// RecordApplicationToFileValidated is RecordApplicationToFile replacing the app file, the appGroup must
+// be one of allowedGroups, otherwise nothing is written. An empty allowedGroups accepts any group.
+func RecordApplicationToFileValidated(appInstance, appGroup string, allowedGroups []string) error {
+	if len(allowedGroups) > 0 && !slices.Contains(allowedGroups, appGroup) {
+		return fmt.Errorf("%w: %q, allowed groups: %s", ErrAppGroupNotAllowed, appGroup, strings.Join(allowedGroups, ", "))
+	}
+	_, err := RecordApplicationToFile(appInstance, appGroup, true)
+	return err
 }
 
-func RecordMapToFile(data map[string]string, filePath string, truncate bool) error {
+// RecordMapToFile writes data as key=value lines, the requiredKeys must be present with non-empty values
+// otherwise nothing is written, because an empty value can't be parsed back.
+func RecordMapToFile(data map[string]string, filePath string, truncate bool, requiredKeys ...string) error {
+	if err := checkRequiredKeys(data, filePath, requiredKeys); err != nil {
+		return err
+	}
 	if len(data) == 0 {
 		return nil
 	}
+	if skip, err := skipPersistence(); skip {
+		return err
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	return writeMapToFile(data, filePath, truncate, 0o666)
+}
+
+// MergeMapToFile updates the keys of data in the file written by RecordMapToFile, the other keys are kept
+func MergeMapToFile(data map[string]string, filePath string, requiredKeys ...string) error {
+	_, err := mergeMapToFile(data, filePath, requiredKeys, false)
+	return err
+}
+
+// mergeMapToFile merges data into the file, the checksum line is added if checksum is set and kept
+// valid if the file has one
+func mergeMapToFile(data map[string]string, filePath string, requiredKeys []string, checksum bool) (ChangeSet, error) {
+	if err := checkRequiredKeys(data, filePath, requiredKeys); err != nil {
+		return ChangeSet{}, err
+	}
+	if len(data) == 0 {
+		return ChangeSet{}, nil
+	}
+	if skip, err := skipPersistence(); skip {
+		return ChangeSet{}, err
+	}
 	mutex.Lock()
 	defer mutex.Unlock()
-	flag := os.O_WRONLY | os.O_CREATE
-	if truncate {
-		flag = flag | os.O_TRUNC
+	previous, err := readMapFromFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return ChangeSet{}, err
 	}
-	file, err := os.OpenFile(filePath, flag, 0o666)
-	defer file.Close()
+	merged := make(map[string]string, len(previous)+len(data))
+	for key, value := range previous {
+		merged[key] = value
+	}
+	for key, value := range data {
+		merged[key] = value
+	}
+	if _, ok := merged[ChecksumKeyName]; ok || checksum {
+		merged[ChecksumKeyName] = appFileChecksum(merged)
+	}
+	if err := writeMapToFile(merged, filePath, true, 0o666); err != nil {
+		return ChangeSet{}, err
+	}
+	return diffMaps(previous, data, false), nil
+}
+
+func checkRequiredKeys(data map[string]string, filePath string, requiredKeys []string) error {
+	for _, key := range requiredKeys {
+		if data[key] == "" {
+			log.WithField("file", filePath).Warningf("%s is empty, skip recording", key)
+			return fmt.Errorf("%s is empty", key)
+		}
+	}
+	return nil
+}
+
+// writeMapToFile writes data to filePath, the caller must hold the mutex
+func writeMapToFile(data map[string]string, filePath string, truncate bool, perm os.FileMode) error {
+	content, err := getFileCodec().Marshal(data)
+	if err != nil {
+		log.WithField("file", filePath).WithError(err).Errorf("encode data failed")
+		return err
+	}
+	authCounters.fileWrites.Add(1)
+	file, err := openFile(filePath, truncate, perm)
 	if err != nil {
 		log.WithField("file", filePath).WithError(err).Errorf("record data to file failed")
 		return err
 	}
-	for key, value := range data {
-		_, err := file.WriteString(strings.Join([]string{key, value}, Delimiter) + "\n")
-		if err != nil {
-			log.WithFields(log.Fields{
-				"file":  filePath,
-				"key":   key,
-				"value": value,
-			}).WithError(err).Errorf("write data to file failed")
-			return err
-		}
+	defer file.Close()
+	if _, err := file.Write(content); err != nil {
+		log.WithField("file", filePath).WithError(err).Errorf("write data to file failed")
+		return err
 	}
 	return nil
 }
 
+// LoadSecretKeyFromFile loads the AK/SK recorded by RecordSecretKeyToFile into memory
+func LoadSecretKeyFromFile() error {
+	return defaultManager.Load()
+}
+
 // ReadAppInfoFromFile returns the local application record
 func ReadAppInfoFromFile() (appInstance, appGroup string, err error) {
-	bytes, err := ioutil.ReadFile(AppFile)
+	appFile := GetAppFile()
+	data, err := readMapFromFile(appFile)
 	if err != nil {
 		return "", "", err
 	}
-	content := strings.TrimSpace(string(bytes))
-	slice := strings.Split(content, "\n")
-	if len(slice) == 0 {
-		return "", "", fmt.Errorf("empty content")
+	_, hasAccessKey := data[AccessKeyName]
+	_, hasSecretKey := data[SecretKeyName]
+	if hasAccessKey || hasSecretKey {
+		return "", "", fmt.Errorf("%s contains AK/SK, it looks like the cert file rather than the app file", appFile)
 	}
-	for _, value := range slice {
-		kv := strings.SplitN(value, Delimiter, 2)
-		if len(kv) != 2 {
+	if err := verifyAppFileChecksum(data); err != nil {
+		return "", "", fmt.Errorf("%w: %s", err, appFile)
+	}
+	return data[AppInstanceKeyName], data[AppGroupKeyName], nil
+}
+
+// readAppInfo is replaced in tests to simulate a hung mount
+var readAppInfo = ReadAppInfoFromFile
+
+// ReadAppInfoFromFileCtx is ReadAppInfoFromFile returning ctx.Err() if ctx is done before the read
+// completes, so that a hung mount doesn't block the caller. The abandoned read finishes in background.
+func ReadAppInfoFromFileCtx(ctx context.Context) (AppInfo, error) {
+	type result struct {
+		info AppInfo
+		err  error
+	}
+	ch := make(chan result, 1)
+	read := readAppInfo
+	go func() {
+		defer PanicPrintStack()
+		appInstance, appGroup, err := read()
+		ch <- result{AppInfo{AppInstance: appInstance, AppGroup: appGroup}, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return AppInfo{}, ctx.Err()
+	case r := <-ch:
+		return r.info, r.err
+	}
+}
+
+// ListKeys returns the sorted keys defined in a file written by RecordMapToFile without reading
+// the values, malformed lines are skipped. Files of another FileCodec are fully parsed.
+func ListKeys(filePath string) ([]string, error) {
+	keys := make(map[string]struct{})
+	if !lineCodec() {
+		data, err := readMapFromFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		for key := range data {
+			keys[key] = struct{}{}
+		}
+	} else if err := scanFileLines(filePath, func(line string) {
+		index := strings.Index(line, Delimiter)
+		if index <= 0 {
+			return
+		}
+		keys[strings.TrimSpace(line[:index])] = struct{}{}
+	}); err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(keys))
+	for key := range keys {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// readMapFromFile parses the key=value lines written by RecordMapToFile, malformed lines are skipped,
+// or the file in the format of the configured FileCodec
+func readMapFromFile(filePath string) (map[string]string, error) {
+	if !lineCodec() {
+		content, err := readFileLimited(filePath, MaxLineLength)
+		if err != nil {
+			return nil, err
+		}
+		if len(content) > MaxLineLength {
+			return nil, fmt.Errorf("%s is larger than %d bytes", filePath, MaxLineLength)
+		}
+		return getFileCodec().Unmarshal(content)
+	}
+	data := make(map[string]string)
+	err := scanFileLines(filePath, func(line string) {
+		parseKeyValueLine(data, line)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// scanFileLines calls handle with each line of filePath, lines longer than MaxLineLength are
+// skipped without being loaded in memory
+func scanFileLines(filePath string, handle func(line string)) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReaderSize(file, MaxLineLength)
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			log.WithField("file", filePath).Warningf("skip line longer than %d bytes", MaxLineLength)
+			for err == bufio.ErrBufferFull {
+				_, err = reader.ReadSlice('\n')
+			}
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
 			continue
 		}
-		switch kv[0] {
-		case AppInstanceKeyName:
-			appInstance = kv[1]
-		case AppGroupKeyName:
-			appGroup = kv[1]
+		if len(line) > 0 {
+			handle(strings.TrimRight(string(line), "\r\n"))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
 		}
 	}
-	return appInstance, appGroup, err
 }
@@ -0,0 +1,795 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// mismatchedSign is a well-formed signature that doesn't match any test payload
+var mismatchedSign = HexBase64Codec{}.Encode(make([]byte, sha256.Size))
+
+// setTestKeys replaces the in-memory keys for the duration of a test
+func setTestKeys(t *testing.T, accessKey, secretKey string) {
+	t.Helper()
+	old, oldSource := defaultManager.loadedFrom()
+	oldPolicy := defaultManager.Policy()
+	defaultManager.credentials.Store(Credentials{AccessKey: accessKey, SecretKey: secretKey})
+	defaultManager.SetPolicy(PolicySignAndVerify)
+	setTestSource(credentialSource{})
+	t.Cleanup(func() {
+		defaultManager.credentials.Store(old)
+		defaultManager.SetPolicy(oldPolicy)
+		setTestSource(oldSource)
+	})
+}
+
+type fakeLatencyObserver struct {
+	lock  sync.Mutex
+	signs []time.Duration
+	auths []time.Duration
+}
+
+func (o *fakeLatencyObserver) ObserveSign(d time.Duration) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.signs = append(o.signs, d)
+}
+
+func (o *fakeLatencyObserver) ObserveAuth(d time.Duration) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.auths = append(o.auths, d)
+}
+
+func TestLatencyObserver(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	observer := &fakeLatencyObserver{}
+	SetLatencyObserver(observer)
+	defer SetLatencyObserver(nil)
+
+	signature := Sign("data")
+	if !Auth(signature, "data") {
+		t.Fatalf("expected signature to verify")
+	}
+	Auth(mismatchedSign, "data")
+
+	if len(observer.signs) != 1 {
+		t.Fatalf("expected 1 sign observation, got %d", len(observer.signs))
+	}
+	if len(observer.auths) != 2 {
+		t.Fatalf("expected 2 auth observations, got %d", len(observer.auths))
+	}
+	for _, d := range append(observer.signs, observer.auths...) {
+		if d <= 0 {
+			t.Errorf("expected positive duration, got %s", d)
+		}
+	}
+}
+
+func TestAuthLegacySignFallback(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	legacySign := Sign("data")
+
+	SetSignFormat(SignFormatBase64)
+	defer SetSignFormat(SignFormatHexBase64)
+	modernSign := Sign("data")
+	if modernSign == legacySign {
+		t.Fatalf("expected formats to differ")
+	}
+
+	SetLegacySignFallback(true)
+	if !Auth(modernSign, "data") {
+		t.Errorf("expected new format to verify during the window")
+	}
+	if !Auth(legacySign, "data") {
+		t.Errorf("expected legacy format to verify during the window")
+	}
+
+	SetLegacySignFallback(false)
+	if !Auth(modernSign, "data") {
+		t.Errorf("expected new format to verify after the window")
+	}
+	if Auth(legacySign, "data") {
+		t.Errorf("expected legacy format to be rejected after the window")
+	}
+}
+
+func setTestSource(source credentialSource) {
+	defaultManager.lock.Lock()
+	defer defaultManager.lock.Unlock()
+	defaultManager.source = source
+}
+
+// setTestFiles points AppFile and CertFile into a temporary directory for the duration of a test
+func setTestFiles(t *testing.T) (appFile, certFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	oldAppFile, oldCertFile := GetAppFile(), GetCertFile()
+	appFile, certFile = filepath.Join(dir, ".chaos.app"), filepath.Join(dir, ".chaos.cert")
+	SetAppFile(appFile)
+	SetCertFile(certFile)
+	t.Cleanup(func() {
+		SetAppFile(oldAppFile)
+		SetCertFile(oldCertFile)
+	})
+	return appFile, certFile
+}
+
+// captureLog redirects the logrus output for the duration of a test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	out := log.StandardLogger().Out
+	log.SetOutput(buf)
+	t.Cleanup(func() {
+		log.SetOutput(out)
+	})
+	return buf
+}
+
+func TestReadAppInfoFromCertFile(t *testing.T) {
+	appFile, _ := setTestFiles(t)
+	if err := os.WriteFile(appFile, []byte("AK=ak\nSK=sk\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := ReadAppInfoFromFile()
+	if err == nil || !strings.Contains(err.Error(), "cert file") {
+		t.Fatalf("expected cert file error, got %v", err)
+	}
+}
+
+func TestLoadSecretKeyFromAppFile(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	buf := captureLog(t)
+	if err := os.WriteFile(certFile, []byte("appInstance=instance\nappGroup=group\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadSecretKeyFromFile(); err == nil {
+		t.Fatalf("expected error loading app file as cert file")
+	}
+	if !strings.Contains(buf.String(), "app file") {
+		t.Errorf("expected warning about app file, got %q", buf.String())
+	}
+}
+
+func TestLoadSecretKeyFromFile(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	setTestKeys(t, "", "")
+	if err := LoadSecretKeyFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	if GetAccessKey() != "ak" || GetSecureKey() != "sk" {
+		t.Errorf("unexpected keys %q/%q", GetAccessKey(), GetSecureKey())
+	}
+}
+
+func TestSignatureLength(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	payloads := []string{"", "data", strings.Repeat("x", 1<<16)}
+
+	if SignatureLength() != 88 {
+		t.Fatalf("expected 88 for the legacy format, got %d", SignatureLength())
+	}
+	for _, payload := range payloads {
+		if got := len(Sign(payload)); got != SignatureLength() {
+			t.Errorf("expected length %d, got %d", SignatureLength(), got)
+		}
+	}
+
+	SetSignFormat(SignFormatBase64)
+	defer SetSignFormat(SignFormatHexBase64)
+	if SignatureLength() != 44 {
+		t.Fatalf("expected 44 for the base64 format, got %d", SignatureLength())
+	}
+	for _, payload := range payloads {
+		if got := len(Sign(payload)); got != SignatureLength() {
+			t.Errorf("expected length %d, got %d", SignatureLength(), got)
+		}
+	}
+}
+
+func TestAppFileConcurrentAccess(t *testing.T) {
+	appFile, _ := setTestFiles(t)
+	if _, err := RecordApplicationToFile("instance", "group", true); err != nil {
+		t.Fatal(err)
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				SetAppFile(appFile)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, _, err := ReadAppInfoFromFile(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestFilePathEnv(t *testing.T) {
+	setTestFiles(t)
+	dir := t.TempDir()
+	SetAppFile("")
+	SetCertFile("")
+	t.Setenv(AppPathEnv, filepath.Join(dir, "app"))
+	t.Setenv(CertPathEnv, filepath.Join(dir, "cert"))
+
+	if GetAppFile() != filepath.Join(dir, "app") {
+		t.Errorf("expected app file from env, got %s", GetAppFile())
+	}
+	if GetCertFile() != filepath.Join(dir, "cert") {
+		t.Errorf("expected cert file from env, got %s", GetCertFile())
+	}
+
+	SetAppFile(filepath.Join(dir, "explicit-app"))
+	SetCertFile(filepath.Join(dir, "explicit-cert"))
+	if GetAppFile() != filepath.Join(dir, "explicit-app") {
+		t.Errorf("expected explicit app file to take precedence, got %s", GetAppFile())
+	}
+	if GetCertFile() != filepath.Join(dir, "explicit-cert") {
+		t.Errorf("expected explicit cert file to take precedence, got %s", GetCertFile())
+	}
+
+	SetAppFile("")
+	SetCertFile("")
+	t.Setenv(AppPathEnv, "")
+	t.Setenv(CertPathEnv, "")
+	if filepath.Base(GetAppFile()) != ".chaos.app" || filepath.Base(GetCertFile()) != ".chaos.cert" {
+		t.Errorf("expected default files, got %s and %s", GetAppFile(), GetCertFile())
+	}
+}
+
+func TestSignAll(t *testing.T) {
+	setTestKeys(t, "ak", "primary")
+	SetSecondarySecretKeys("secondary")
+	defer SetSecondarySecretKeys()
+
+	signs := SignAll("data")
+	if len(signs) != 2 {
+		t.Fatalf("expected 2 signatures, got %d", len(signs))
+	}
+	if signs[KeyFingerprint("primary")] != Sign("data") {
+		t.Errorf("expected primary signature to match Sign")
+	}
+	secondarySign, ok := signs[KeyFingerprint("secondary")]
+	if !ok {
+		t.Fatalf("expected signature for the secondary key")
+	}
+	if !Auth(secondarySign, "data") {
+		t.Errorf("expected secondary signature to verify")
+	}
+	for fingerprint, signature := range signs {
+		if strings.Contains(fingerprint, "primary") || strings.Contains(fingerprint, "secondary") ||
+			strings.Contains(signature, "primary") || strings.Contains(signature, "secondary") {
+			t.Errorf("secret key exposed in %s=%s", fingerprint, signature)
+		}
+	}
+}
+
+func TestRecordSecretKeyToFileEmptyValue(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	if err := RecordSecretKeyToFile("ak", ""); err == nil {
+		t.Errorf("expected error for empty SK")
+	}
+	if err := RecordSecretKeyToFile("", "sk"); err == nil {
+		t.Errorf("expected error for empty AK")
+	}
+	if IsExist(certFile) {
+		t.Errorf("expected cert file not to be written")
+	}
+	if GetAccessKey() != "" || GetSecureKey() != "" {
+		t.Errorf("expected keys not to be updated")
+	}
+}
+
+func TestRecordMapToFileRequiredKeys(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "map")
+	if err := RecordMapToFile(nil, filePath, true, "key"); err == nil {
+		t.Errorf("expected error for nil map with required key")
+	}
+	if err := RecordMapToFile(map[string]string{"key": "", "other": ""}, filePath, true, "key"); err == nil {
+		t.Errorf("expected error for empty required value")
+	}
+	if IsExist(filePath) {
+		t.Fatalf("expected file not to be written")
+	}
+	if err := RecordMapToFile(map[string]string{"key": "value", "other": ""}, filePath, true, "key"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := readMapFromFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["key"] != "value" {
+		t.Errorf("unexpected data %v", data)
+	}
+}
+
+func TestSigningString(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	for _, signData := range []string{"", "data", `{"ts":"1"}`} {
+		sum256 := sha256.Sum256([]byte(SigningString(signData) + "sk"))
+		expected := base64.StdEncoding.EncodeToString([]byte(hex.EncodeToString(sum256[:])))
+		if Sign(signData) != expected {
+			t.Errorf("expected Sign to hash SigningString(%q) followed by the SK", signData)
+		}
+	}
+}
+
+func TestOnCredentialsLoaded(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	defaultManager.lock.Lock()
+	oldCallbacks := defaultManager.callbacks
+	defaultManager.lock.Unlock()
+	defer func() {
+		defaultManager.lock.Lock()
+		defaultManager.callbacks = oldCallbacks
+		defaultManager.lock.Unlock()
+	}()
+
+	var loaded []string
+	OnCredentialsLoaded(func(ak string) {
+		loaded = append(loaded, ak)
+	})
+	if err := os.WriteFile(certFile, []byte("AK=ak1\nSK=sk1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadSecretKeyFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	// unchanged keys don't fire the callback
+	if err := LoadSecretKeyFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordSecretKeyToFile("ak2", "sk2"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(loaded, ",") != "ak1,ak2" {
+		t.Errorf("unexpected callbacks %v", loaded)
+	}
+}
+
+func TestWrapBase64(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	signature := Sign("data")
+	wrapped := WrapBase64(signature, 64, "\n")
+	lines := strings.Split(wrapped, "\n")
+	if len(lines) != 2 || len(lines[0]) != 64 || lines[0]+lines[1] != signature {
+		t.Fatalf("unexpected wrapping %q", wrapped)
+	}
+	if UnwrapBase64(wrapped, "\n") != signature {
+		t.Errorf("expected unwrap to restore the signature")
+	}
+	if WrapBase64(UnwrapBase64(wrapped, "\n"), 64, "\n") != wrapped {
+		t.Errorf("expected wrap after unwrap to be idempotent")
+	}
+	if WrapBase64("short", 64, "\n") != "short" {
+		t.Errorf("expected short string to be unchanged")
+	}
+	if WrapBase64(strings.Repeat("a", 128), 64, "\n") != strings.Repeat("a", 64)+"\n"+strings.Repeat("a", 64) {
+		t.Errorf("expected no trailing separator for exact multiple of width")
+	}
+}
+
+func TestListKeys(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), ".chaos.app")
+	content := "appInstance=a\nappGroup=g\nmalformed\n=novalue\nappInstance=b\n\nstate=\n"
+	if err := os.WriteFile(filePath, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ListKeys(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(keys, ",") != "appGroup,appInstance,state" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+}
+
+func TestAuthFailureLogRateLimited(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	SetAuthFailureLogWindow(time.Hour)
+	defer SetAuthFailureLogWindow(10 * time.Second)
+	buf := captureLog(t)
+
+	for i := 0; i < 100; i++ {
+		Auth(mismatchedSign, "data")
+	}
+	if count := strings.Count(buf.String(), "Sign not equal"); count != 1 {
+		t.Errorf("expected 1 warning for 100 failures, got %d", count)
+	}
+
+	SetAuthFailureLogWindow(time.Millisecond)
+	Auth(mismatchedSign, "data")
+	Auth(mismatchedSign, "data")
+	time.Sleep(5 * time.Millisecond)
+	Auth(mismatchedSign, "data")
+	if !strings.Contains(buf.String(), "suppressed: 1") {
+		t.Errorf("expected suppressed count summary, got %q", buf.String())
+	}
+}
+
+func TestRecentAuthEventsWhenLogDiscarded(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	SetAuthFailureLogWindow(0)
+	defer SetAuthFailureLogWindow(10 * time.Second)
+	out := log.StandardLogger().Out
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(out)
+	before := len(RecentAuthEvents())
+
+	Auth(mismatchedSign, "data")
+	events := RecentAuthEvents()
+	if len(events) == 0 || len(events) <= before && before < maxAuthEvents {
+		t.Fatalf("expected the failure to be recorded, got %v", events)
+	}
+	last := events[len(events)-1]
+	if last.AccessKey != "ak" || last.Message != "sign not equal" {
+		t.Errorf("unexpected event %+v", last)
+	}
+
+	for i := 0; i < 2*maxAuthEvents; i++ {
+		Auth(mismatchedSign, "data")
+	}
+	if count := len(RecentAuthEvents()); count != maxAuthEvents {
+		t.Errorf("expected the events to be bounded to %d, got %d", maxAuthEvents, count)
+	}
+
+	buf := captureLog(t)
+	events = RecentAuthEvents()
+	Auth(mismatchedSign, "data")
+	if !strings.Contains(buf.String(), "Sign not equal") {
+		t.Errorf("expected the failure to be logged, got %q", buf.String())
+	}
+	if latest := RecentAuthEvents(); latest[len(latest)-1] != events[len(events)-1] {
+		t.Errorf("expected no event recorded while logging works")
+	}
+}
+
+func TestRecordApplicationToFileValidated(t *testing.T) {
+	setTestFiles(t)
+	allowed := []string{"groupA", "groupB"}
+	if err := RecordApplicationToFileValidated("instance", "groupB", allowed); err != nil {
+		t.Fatal(err)
+	}
+	err := RecordApplicationToFileValidated("instance", "gruopA", allowed)
+	if !errors.Is(err, ErrAppGroupNotAllowed) {
+		t.Errorf("expected ErrAppGroupNotAllowed, got %v", err)
+	}
+	if _, appGroup, err := ReadAppInfoFromFile(); err != nil || appGroup != "groupB" {
+		t.Errorf("expected the rejected group not to be written, got %q, %v", appGroup, err)
+	}
+	if err := RecordApplicationToFileValidated("instance", "any", nil); err != nil {
+		t.Errorf("expected any group to be accepted without an allowlist, got %v", err)
+	}
+}
+
+func TestAuthErrMalformedSignature(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	captureLog(t)
+	SetSignFormat(SignFormatBase64)
+	defer SetSignFormat(SignFormatHexBase64)
+	sign := Sign("data")
+	urlSign := base64.URLEncoding.EncodeToString(digest("data", "sk"))
+	if urlSign == sign {
+		t.Fatal("expected the test digest to differ between the alphabets")
+	}
+
+	tests := []struct {
+		name      string
+		signature string
+		expected  error
+	}{
+		{"valid", sign, nil},
+		{"mismatched", Sign("other"), ErrSignMismatch},
+		{"not base64", "not base64!", ErrMalformedSignature},
+		{"wrong alphabet", urlSign, ErrMalformedSignature},
+		{"empty", "", ErrSignMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := AuthErr(tt.signature, "data"); !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+			if Auth(tt.signature, "data") != (tt.expected == nil) {
+				t.Errorf("expected Auth to agree with AuthErr")
+			}
+		})
+	}
+}
+
+func TestSignTrimmed(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	captureLog(t)
+	inputs := []string{"data", "data\n", "data\r\n", "data \t\n\n"}
+	for _, signed := range inputs {
+		for _, verified := range inputs {
+			if !AuthTrimmed(SignTrimmed(signed), verified) {
+				t.Errorf("expected %q signed to verify as %q", signed, verified)
+			}
+		}
+	}
+	if AuthTrimmed(SignTrimmed("data"), "\ndata") {
+		t.Errorf("expected leading whitespace to be kept")
+	}
+	if Auth(Sign("data\n"), "data") {
+		t.Errorf("expected Auth not to trim")
+	}
+}
+
+func TestHomeDirUnavailable(t *testing.T) {
+	setTestKeys(t, "", "")
+	t.Setenv(CertPathEnv, "")
+	mutex.RLock()
+	oldCertFile := certFile
+	mutex.RUnlock()
+	SetCertFile("")
+	userHome = func() string {
+		return ""
+	}
+	// registered before setTestFiles so that it runs after its cleanup
+	t.Cleanup(func() {
+		userHome = GetUserHome
+		SetCertFile(oldCertFile)
+	})
+	if err := RecordSecretKeyToFile("ak", "sk"); !errors.Is(err, ErrHomeDirUnavailable) {
+		t.Errorf("expected ErrHomeDirUnavailable, got %v", err)
+	}
+	if err := LoadSecretKeyFromFile(); !errors.Is(err, ErrHomeDirUnavailable) {
+		t.Errorf("expected ErrHomeDirUnavailable, got %v", err)
+	}
+	for name, access := range map[string]func() error{
+		"CommitAll":                func() error { return CommitAll(Credentials{"ak", "sk"}, AppInfo{}) },
+		"RecordSecretKeyBinary":    func() error { return RecordSecretKeyBinary("ak", "sk") },
+		"LoadSecretKeyBinary":      LoadSecretKeyBinary,
+		"RecordSecretKeyEncrypted": func() error { return RecordSecretKeyEncrypted("ak", "sk", make([]byte, 32)) },
+		"LoadSecretKeyEncrypted":   func() error { return LoadSecretKeyEncrypted(make([]byte, 32)) },
+		"RekeyCredentialFile":      func() error { return RekeyCredentialFile(make([]byte, 32), make([]byte, 32)) },
+		"RecordCredentialExpiry":   func() error { return RecordCredentialExpiry(time.Time{}) },
+		"MigrateCredentialFile":    MigrateCredentialFile,
+		"RollbackCredentials":      RollbackCredentials,
+		"ReadPrivateKeyPEM": func() error {
+			_, err := ReadPrivateKeyPEM()
+			return err
+		},
+		"FileCredentialProvider": func() error {
+			_, _, err := FileCredentialProvider{}.Retrieve(context.Background())
+			return err
+		},
+	} {
+		setTestKeys(t, "ak", "sk")
+		if err := access(); !errors.Is(err, ErrHomeDirUnavailable) {
+			t.Errorf("expected ErrHomeDirUnavailable from %s, got %v", name, err)
+		}
+	}
+	if _, err := os.Stat(".chaos.cert"); !os.IsNotExist(err) {
+		t.Errorf("expected no cert file in the working directory, got %v", err)
+	}
+
+	_, certFile := setTestFiles(t)
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Errorf("expected the explicit path to be used, got %v", err)
+	}
+	if _, err := os.Stat(certFile); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSignConcurrentRotation(t *testing.T) {
+	setTestKeys(t, "ak", "sk1")
+	setTestFiles(t)
+	expected := map[string]bool{
+		signWithKey("data", "sk1", HexBase64Codec{}): true,
+		signWithKey("data", "sk2", HexBase64Codec{}): true,
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			secretKey := "sk1"
+			if i%2 == 0 {
+				secretKey = "sk2"
+			}
+			if err := RecordSecretKeyToFile("ak", secretKey); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if sign := Sign("data"); !expected[sign] {
+			t.Fatalf("signature %s doesn't belong to any key", sign)
+		}
+	}
+}
+
+func TestRecordSecretKeyToFileMissingDir(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	dir := filepath.Join(t.TempDir(), "missing")
+	SetCertFile(filepath.Join(dir, ".chaos.cert"))
+
+	err := RecordSecretKeyToFile("ak", "sk")
+	if !errors.Is(err, ErrCredentialDirMissing) || !strings.Contains(err.Error(), dir) {
+		t.Fatalf("expected ErrCredentialDirMissing with the directory, got %v", err)
+	}
+	if IsExist(dir) {
+		t.Errorf("expected directory not to be created")
+	}
+
+	if err := RecordSecretKeyToFileMkdir("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	if !IsExist(GetCertFile()) {
+		t.Errorf("expected cert file to be created")
+	}
+}
+
+func TestAuthBytes(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	sign := Sign("data")
+	if !AuthBytes(sign, []byte("data")) {
+		t.Errorf("expected signature to verify")
+	}
+	if AuthBytes(sign, []byte("other")) {
+		t.Errorf("expected signature of other data to be rejected")
+	}
+	if !bytes.Equal(digestBytes([]byte("data"), "sk"), digest("data", "sk")) {
+		t.Errorf("expected digestBytes to match digest")
+	}
+}
+
+func BenchmarkAuthString(b *testing.B) {
+	setCredentials("ak", "sk")
+	data := []byte(strings.Repeat("x", 4096))
+	sign := Sign(string(data))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Auth(sign, string(data))
+	}
+}
+
+func BenchmarkAuthBytes(b *testing.B) {
+	setCredentials("ak", "sk")
+	data := []byte(strings.Repeat("x", 4096))
+	sign := Sign(string(data))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		AuthBytes(sign, data)
+	}
+}
+
+func TestReadAppInfoFromFileCtx(t *testing.T) {
+	setTestFiles(t)
+	if _, err := RecordApplicationToFile("instance", "group", true); err != nil {
+		t.Fatal(err)
+	}
+	info, err := ReadAppInfoFromFileCtx(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.AppInstance != "instance" || info.AppGroup != "group" {
+		t.Errorf("unexpected app info %+v", info)
+	}
+
+	block := make(chan struct{})
+	readAppInfo = func() (string, string, error) {
+		<-block
+		return "stale", "stale", nil
+	}
+	defer func() {
+		close(block)
+		readAppInfo = ReadAppInfoFromFile
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	info, err = ReadAppInfoFromFileCtx(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if info != (AppInfo{}) {
+		t.Errorf("expected empty app info, got %+v", info)
+	}
+}
+
+func TestReadMapFromFileLongLine(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), ".chaos.app")
+	content := "appInstance=instance\nappGroup=" + strings.Repeat("x", 4*MaxLineLength) + "\nstate=PENDING"
+	if err := os.WriteFile(filePath, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	captureLog(t)
+	data, err := readMapFromFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2 || data[AppInstanceKeyName] != "instance" || data["state"] != "PENDING" {
+		t.Errorf("expected the long line to be skipped, got %d keys", len(data))
+	}
+	keys, err := ListKeys(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(keys, ",") != "appInstance,state" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+}
+
+func TestAgentDisplayID(t *testing.T) {
+	setTestKeys(t, "", "sk")
+	if AgentDisplayID() != "" {
+		t.Errorf("expected no display ID without AK")
+	}
+	setTestKeys(t, "LTAI5tQ9xExampleAccessKeyId", "sk")
+	id := AgentDisplayID()
+	if len(id) != 16 || strings.ToLower(id) != id {
+		t.Fatalf("expected 16 lowercase characters, got %q", id)
+	}
+	setTestKeys(t, "LTAI5tQ9xExampleAccessKeyId", "rotated-sk")
+	if AgentDisplayID() != id {
+		t.Errorf("expected the display ID to depend on the AK only")
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100000; i++ {
+		setCredentials("ak-"+strconv.Itoa(i), "sk")
+		id := AgentDisplayID()
+		if seen[id] {
+			t.Fatalf("unexpected collision after %d AKs", i)
+		}
+		seen[id] = true
+	}
+}
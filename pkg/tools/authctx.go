@@ -0,0 +1,51 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"context"
+)
+
+type secretKeyContextKey struct{}
+
+// WithSecretKey returns a copy of ctx carrying the SK that AuthCtx verifies against
+func WithSecretKey(ctx context.Context, secretKey string) context.Context {
+	return context.WithValue(ctx, secretKeyContextKey{}, secretKey)
+}
+
+// SecretKeyFromContext returns the SK stored in ctx by WithSecretKey
+func SecretKeyFromContext(ctx context.Context) (string, bool) {
+	secretKey, ok := ctx.Value(secretKeyContextKey{}).(string)
+	return secretKey, ok && secretKey != ""
+}
+
+// AuthCtx is Auth with the SK resolved per request, a server stores it in the request context by WithSecretKey.
+// Without an SK in ctx it falls back to the globally loaded key. It fails closed while disabled.
+func AuthCtx(ctx context.Context, signature, signData string) bool {
+	secretKey, ok := SecretKeyFromContext(ctx)
+	if !ok {
+		return Auth(signature, signData)
+	}
+	if credentialsDisabled.Load() || checkSignDataLength(len(signData)) != nil {
+		authCounters.countAuth(false)
+		return false
+	}
+	codec, _ := getSignatureCodec()
+	verified := verifyWithKey(signature, signData, secretKey, codec)
+	authCounters.countAuth(verified)
+	return verified
+}
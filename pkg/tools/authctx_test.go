@@ -0,0 +1,54 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAuthCtxWithSecretKey(t *testing.T) {
+	setTestKeys(t, "ak", "global")
+	captureLog(t)
+	setTestKeys(t, "ak", "request")
+	sign := Sign("data")
+	setTestKeys(t, "ak", "global")
+
+	ctx := WithSecretKey(context.Background(), "request")
+	if !AuthCtx(ctx, sign, "data") {
+		t.Error("expected the signature to verify against the SK in the context")
+	}
+	if AuthCtx(ctx, Sign("data"), "data") {
+		t.Error("expected the global SK not to be used when the context has an SK")
+	}
+}
+
+func TestAuthCtxWithoutSecretKey(t *testing.T) {
+	setTestKeys(t, "ak", "global")
+	captureLog(t)
+	sign := Sign("data")
+
+	if !AuthCtx(context.Background(), sign, "data") {
+		t.Error("expected fallback to the global SK")
+	}
+	if !AuthCtx(WithSecretKey(context.Background(), ""), sign, "data") {
+		t.Error("expected an empty SK in the context to fall back to the global SK")
+	}
+	if AuthCtx(context.Background(), sign, "other") {
+		t.Error("expected a mismatched payload to fail")
+	}
+}
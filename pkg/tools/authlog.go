@@ -0,0 +1,136 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxAuthEvents bounds the auth events kept when the logger discards its output
+const maxAuthEvents = 128
+
+// authFailureLimiter limits the auth failure warnings to one per AK per window, counting the
+// suppressed ones so that they can be summarized in the next warning.
+type authFailureLimiter struct {
+	lock       sync.Mutex
+	window     time.Duration
+	last       map[string]time.Time
+	suppressed map[string]int
+}
+
+var authFailureLogLimiter = &authFailureLimiter{
+	window:     10 * time.Second,
+	last:       make(map[string]time.Time),
+	suppressed: make(map[string]int),
+}
+
+// SetAuthFailureLogWindow sets the minimum interval between two auth failure warnings of the same AK,
+// 0 logs every failure
+func SetAuthFailureLogWindow(window time.Duration) {
+	authFailureLogLimiter.lock.Lock()
+	defer authFailureLogLimiter.lock.Unlock()
+	authFailureLogLimiter.window = window
+	authFailureLogLimiter.last = make(map[string]time.Time)
+	authFailureLogLimiter.suppressed = make(map[string]int)
+}
+
+// allow returns whether the failure of ak should be logged, and how many were suppressed since the last one
+func (limiter *authFailureLimiter) allow(ak string) (bool, int) {
+	ok, suppressed := limiter.record(ak)
+	enforceCacheMemoryLimit()
+	return ok, suppressed
+}
+
+func (limiter *authFailureLimiter) record(ak string) (bool, int) {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	if limiter.window <= 0 {
+		return true, 0
+	}
+	now := time.Now()
+	if last, ok := limiter.last[ak]; ok && now.Sub(last) < limiter.window {
+		limiter.suppressed[ak]++
+		return false, 0
+	}
+	if len(limiter.last) > 1024 {
+		for key, last := range limiter.last {
+			if now.Sub(last) >= limiter.window {
+				delete(limiter.last, key)
+				delete(limiter.suppressed, key)
+			}
+		}
+	}
+	suppressed := limiter.suppressed[ak]
+	limiter.last[ak] = now
+	delete(limiter.suppressed, ak)
+	return true, suppressed
+}
+
+// AuthEvent is an auth failure or warning kept by RecentAuthEvents
+type AuthEvent struct {
+	Time      time.Time
+	AccessKey string
+	Message   string
+}
+
+// authEventRing keeps the last auth events in a bounded ring
+type authEventRing struct {
+	lock   sync.Mutex
+	events []AuthEvent
+	next   int
+}
+
+var authEvents = &authEventRing{}
+
+// recordAuthEvent keeps an auth event when the standard logger discards its output,
+// so that auth failures don't vanish in embeddings that silence logrus
+func recordAuthEvent(ak, message string) {
+	if !logDiscarded() {
+		return
+	}
+	authEvents.add(AuthEvent{Time: time.Now(), AccessKey: ak, Message: message})
+}
+
+func logDiscarded() bool {
+	out := log.StandardLogger().Out
+	return out == nil || out == io.Discard
+}
+
+func (ring *authEventRing) add(event AuthEvent) {
+	ring.lock.Lock()
+	defer ring.lock.Unlock()
+	if len(ring.events) < maxAuthEvents {
+		ring.events = append(ring.events, event)
+		return
+	}
+	ring.events[ring.next] = event
+	ring.next = (ring.next + 1) % maxAuthEvents
+}
+
+// RecentAuthEvents returns the last auth failures, oldest first. They're only kept while the standard
+// logger output is discarded, otherwise they're logged as usual.
+func RecentAuthEvents() []AuthEvent {
+	authEvents.lock.Lock()
+	defer authEvents.lock.Unlock()
+	events := make([]AuthEvent, 0, len(authEvents.events))
+	events = append(events, authEvents.events[authEvents.next:]...)
+	return append(events, authEvents.events[:authEvents.next]...)
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	binaryCertMagic   = "CHCE"
+	binaryCertVersion = 1
+)
+
+var (
+	ErrInvalidBinaryCert  = errors.New("invalid binary cert file")
+	ErrBinaryCertTampered = errors.New("binary cert file integrity check failed")
+
+	// hostSecret keys the integrity MAC of the binary cert file, so a file edited by hand
+	// or copied from another host is detected.
+	hostSecret = func() []byte {
+		if machineId, err := ioutil.ReadFile("/etc/machine-id"); err == nil && len(bytes.TrimSpace(machineId)) > 0 {
+			return bytes.TrimSpace(machineId)
+		}
+		hostname, _ := os.Hostname()
+		return []byte(hostname)
+	}
+)
+
+// RecordSecretKeyBinary records AK/SK to the cert file in the tamper-evident binary format:
+// magic, version, length-prefixed AK and SK, then an HMAC-SHA256 over the preceding bytes.
+func RecordSecretKeyBinary(accessKey, secretKey string) error {
+	if accessKey == "" || secretKey == "" {
+		return errors.New("accessKey or secretKey is empty")
+	}
+	if err := checkSecretStrength(secretKey); err != nil {
+		return err
+	}
+	if skip, err := skipPersistence(); skip {
+		setCredentials(accessKey, secretKey)
+		return err
+	}
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return err
+	}
+	content, err := encodeBinaryCert(accessKey, secretKey)
+	if err != nil {
+		return err
+	}
+	mutex.Lock()
+	authCounters.fileWrites.Add(1)
+	err = writePrivateFile(certFile, content)
+	mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	recordCertFileState(certFile)
+	return setCredentialsFrom(certFileSource(certFile, certFormatBinary), accessKey, secretKey)
+}
+
+// LoadSecretKeyBinary loads AK/SK from the binary cert file, rejecting files that fail the integrity check
+func LoadSecretKeyBinary() error {
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return err
+	}
+	accessKey, secretKey, err := decodeBinaryCert(content)
+	if err != nil {
+		return err
+	}
+	if err := checkSecretStrength(secretKey); err != nil {
+		return err
+	}
+	recordCertFileState(certFile)
+	return setCredentialsFrom(certFileSource(certFile, certFormatBinary), accessKey, secretKey)
+}
+
+func encodeBinaryCert(fields ...string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(binaryCertMagic)
+	buf.WriteByte(binaryCertVersion)
+	for _, field := range fields {
+		if len(field) > 0xffff {
+			return nil, fmt.Errorf("field too long: %d", len(field))
+		}
+		binary.Write(buf, binary.BigEndian, uint16(len(field)))
+		buf.WriteString(field)
+	}
+	buf.Write(binaryCertMAC(buf.Bytes()))
+	return buf.Bytes(), nil
+}
+
+func decodeBinaryCert(content []byte) (accessKey, secretKey string, err error) {
+	headerLen := len(binaryCertMagic) + 1
+	if len(content) < headerLen+sha256.Size || string(content[:len(binaryCertMagic)]) != binaryCertMagic {
+		return "", "", ErrInvalidBinaryCert
+	}
+	if content[len(binaryCertMagic)] != binaryCertVersion {
+		return "", "", fmt.Errorf("%w: unsupported version %d", ErrInvalidBinaryCert, content[len(binaryCertMagic)])
+	}
+	body, mac := content[:len(content)-sha256.Size], content[len(content)-sha256.Size:]
+	if !hmac.Equal(mac, binaryCertMAC(body)) {
+		return "", "", ErrBinaryCertTampered
+	}
+	fields := make([]string, 0, 2)
+	rest := body[headerLen:]
+	for len(rest) > 0 {
+		if len(rest) < 2 {
+			return "", "", ErrInvalidBinaryCert
+		}
+		size := int(binary.BigEndian.Uint16(rest))
+		if len(rest) < 2+size {
+			return "", "", ErrInvalidBinaryCert
+		}
+		fields, rest = append(fields, string(rest[2:2+size])), rest[2+size:]
+	}
+	if len(fields) != 2 || fields[0] == "" || fields[1] == "" {
+		return "", "", ErrInvalidBinaryCert
+	}
+	return fields[0], fields[1], nil
+}
+
+func binaryCertMAC(body []byte) []byte {
+	h := hmac.New(sha256.New, hostSecret())
+	h.Write(body)
+	return h.Sum(nil)
+}
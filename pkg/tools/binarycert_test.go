@@ -0,0 +1,69 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestBinaryCertRoundTrip(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	if err := RecordSecretKeyBinary("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	setTestKeys(t, "", "")
+	if err := LoadSecretKeyBinary(); err != nil {
+		t.Fatal(err)
+	}
+	if GetAccessKey() != "ak" || GetSecureKey() != "sk" {
+		t.Errorf("unexpected keys %q/%q", GetAccessKey(), GetSecureKey())
+	}
+}
+
+func TestBinaryCertTampered(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	if err := RecordSecretKeyBinary("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flip the last byte of SK
+	content[len(content)-33] ^= 0xff
+	if err := os.WriteFile(certFile, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	setTestKeys(t, "", "")
+	if err := LoadSecretKeyBinary(); !errors.Is(err, ErrBinaryCertTampered) {
+		t.Errorf("expected ErrBinaryCertTampered, got %v", err)
+	}
+	if GetSecureKey() != "" {
+		t.Errorf("expected tampered key not to be loaded")
+	}
+
+	if err := os.WriteFile(certFile, []byte("AK=ak\nSK=sk\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadSecretKeyBinary(); !errors.Is(err, ErrInvalidBinaryCert) {
+		t.Errorf("expected ErrInvalidBinaryCert for text file, got %v", err)
+	}
+}
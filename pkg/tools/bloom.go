@@ -0,0 +1,113 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"hash/maphash"
+	"math"
+	"sync"
+	"time"
+)
+
+// BloomNonceStore remembers the nonces seen within a window in bounded memory, for volumes where an
+// exact store would be evicted before the window ends. It rotates two bloom filters each covering
+// the window, so a nonce is remembered for at least the window and forgotten after twice the window.
+// A fresh nonce is rejected with about the configured false-positive rate.
+type BloomNonceStore struct {
+	lock     sync.Mutex
+	window   time.Duration
+	bits     uint64
+	hashes   int
+	seeds    [2]maphash.Seed
+	current  []uint64
+	previous []uint64
+	rotateAt time.Time
+}
+
+// NewBloomNonceStore returns a store for up to expected nonces per window with a false-positive rate of fpRate
+func NewBloomNonceStore(window time.Duration, expected int, fpRate float64) (*BloomNonceStore, error) {
+	if window <= 0 || expected <= 0 {
+		return nil, errors.New("window and expected must be greater than 0")
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		return nil, errors.New("fpRate must be between 0 and 1")
+	}
+	// a nonce is checked against both filters, each gets half of the rate
+	p := fpRate / 2
+	bits := uint64(math.Ceil(-float64(expected) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	bits = (bits + 63) / 64 * 64
+	hashes := int(math.Max(1, math.Round(float64(bits)/float64(expected)*math.Ln2)))
+	return &BloomNonceStore{
+		window:   window,
+		bits:     bits,
+		hashes:   hashes,
+		seeds:    [2]maphash.Seed{maphash.MakeSeed(), maphash.MakeSeed()},
+		current:  make([]uint64, bits/64),
+		previous: make([]uint64, bits/64),
+		rotateAt: timeNow().Add(window),
+	}, nil
+}
+
+// CheckAndAdd records the nonce and returns true if it wasn't seen within the window, false if it's
+// probably a replay
+func (store *BloomNonceStore) CheckAndAdd(nonce string) bool {
+	return !store.probe(nonce, true)
+}
+
+// probe returns whether the nonce is probably in either filter, and sets it in the current one if add is
+// set. Each filter is probed on its own: probing their union would exceed the rate once both are full.
+func (store *BloomNonceStore) probe(nonce string, add bool) bool {
+	h1 := maphash.String(store.seeds[0], nonce)
+	h2 := maphash.String(store.seeds[1], nonce) | 1
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.rotate()
+	inCurrent, inPrevious := true, true
+	for i := 0; i < store.hashes; i++ {
+		index := (h1 + uint64(i)*h2) % store.bits
+		word, mask := index/64, uint64(1)<<(index%64)
+		if store.current[word]&mask == 0 {
+			inCurrent = false
+		}
+		if store.previous[word]&mask == 0 {
+			inPrevious = false
+		}
+		if add {
+			store.current[word] |= mask
+		}
+	}
+	return inCurrent || inPrevious
+}
+
+// rotate replaces the previous filter with the current one every window, the caller holds the lock
+func (store *BloomNonceStore) rotate() {
+	now := timeNow()
+	if now.Before(store.rotateAt) {
+		return
+	}
+	if now.Before(store.rotateAt.Add(store.window)) {
+		store.previous, store.current = store.current, store.previous
+	} else {
+		// idle for more than a window, both filters are stale
+		clear(store.previous)
+	}
+	clear(store.current)
+	for !now.Before(store.rotateAt) {
+		store.rotateAt = store.rotateAt.Add(store.window)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBloomNonceStoreFalsePositiveRate(t *testing.T) {
+	const expected, fpRate = 10000, 0.01
+	store, err := NewBloomNonceStore(time.Hour, expected, fpRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < expected; i++ {
+		nonce := "seen-" + strconv.Itoa(i)
+		store.CheckAndAdd(nonce)
+		if store.CheckAndAdd(nonce) {
+			t.Fatalf("expected the replay of %s to be rejected", nonce)
+		}
+	}
+	rejected := 0
+	for i := 0; i < expected; i++ {
+		if store.probe("fresh-"+strconv.Itoa(i), false) {
+			rejected++
+		}
+	}
+	if rate := float64(rejected) / expected; rate > fpRate {
+		t.Errorf("expected a false-positive rate under %v, got %v", fpRate, rate)
+	}
+}
+
+func TestBloomNonceStoreFalsePositiveRateAfterRotation(t *testing.T) {
+	const expected, fpRate = 10000, 0.01
+	store, err := NewBloomNonceStore(time.Minute, expected, fpRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < expected; i++ {
+		store.CheckAndAdd("first-" + strconv.Itoa(i))
+	}
+	setTestNow(t, 90*time.Second)
+	for i := 0; i < expected; i++ {
+		store.CheckAndAdd("second-" + strconv.Itoa(i))
+	}
+	// the rate of both filters adds up to about fpRate, allow for the sampling error
+	const probes = 10 * expected
+	rejected := 0
+	for i := 0; i < probes; i++ {
+		if store.probe("fresh-"+strconv.Itoa(i), false) {
+			rejected++
+		}
+	}
+	if rate := float64(rejected) / probes; rate > fpRate*1.25 {
+		t.Errorf("expected a false-positive rate about %v with both filters full, got %v", fpRate, rate)
+	}
+}
+
+func TestBloomNonceStoreForgetsOldNonces(t *testing.T) {
+	store, err := NewBloomNonceStore(time.Minute, 100, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !store.CheckAndAdd("nonce") {
+		t.Fatal("expected a fresh nonce to be accepted")
+	}
+	setTestNow(t, 90*time.Second)
+	if store.CheckAndAdd("nonce") {
+		t.Error("expected the nonce to be remembered after a rotation")
+	}
+	setTestNow(t, 5*time.Minute)
+	if !store.CheckAndAdd("nonce") {
+		t.Error("expected the nonce to be forgotten after twice the window")
+	}
+}
+
+func TestNewBloomNonceStoreInvalid(t *testing.T) {
+	if _, err := NewBloomNonceStore(0, 100, 0.01); err == nil {
+		t.Error("expected an error for an empty window")
+	}
+	if _, err := NewBloomNonceStore(time.Minute, 100, 1); err == nil {
+		t.Error("expected an error for an invalid rate")
+	}
+}
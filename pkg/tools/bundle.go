@@ -0,0 +1,231 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// verifyBundleVersion is bumped whenever the format of the verify bundle changes
+const verifyBundleVersion = 1
+
+var (
+	ErrSecretExportNotAllowed = errors.New("exporting the secret key isn't allowed")
+	ErrInvalidBundle          = errors.New("invalid verify bundle")
+	ErrAKNotInBundle          = errors.New("ak not in the verify bundle")
+
+	// secretBundleExport is the explicit consent to export the SK in a verify bundle
+	secretBundleExport atomic.Bool
+)
+
+// verifyBundle is the JSON exported by ExportVerifyBundle
+type verifyBundle struct {
+	Version int               `json:"version"`
+	Keys    []verifyBundleKey `json:"keys"`
+}
+
+// verifyBundleKey holds either the PKIX public key of an AK, or its SK when its export was allowed
+type verifyBundleKey struct {
+	AccessKey   string    `json:"ak"`
+	PublicKey   string    `json:"publicKey,omitempty"`
+	SecretKey   string    `json:"secretKey,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Algorithm   *AlgoSpec `json:"algorithm,omitempty"`
+}
+
+// AllowSecretBundleExport is the explicit consent for ExportVerifyBundle to export the SK of an agent
+// without private key. Anyone holding such a bundle can sign as the agent.
+func AllowSecretBundleExport(allowed bool) {
+	secretBundleExport.Store(allowed)
+}
+
+// ExportVerifyBundle exports what an auditor needs to verify signed records of the agent offline with
+// VerifyWithBundle. With a private key in the cert file, only its public key is exported. Otherwise the
+// SK is, with the scheme of Sign, provided AllowSecretBundleExport was called, else ErrSecretExportNotAllowed.
+func ExportVerifyBundle() ([]byte, error) {
+	if err := checkCredentialsEnabled(); err != nil {
+		return nil, err
+	}
+	accessKey := GetAccessKey()
+	if accessKey == "" {
+		return nil, errors.New("accessKey is empty")
+	}
+	key := verifyBundleKey{AccessKey: accessKey}
+	pemData, err := ReadPrivateKeyPEM()
+	switch {
+	case err == nil:
+		if key.PublicKey, err = exportPublicKey(pemData); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, ErrNoPrivateKey):
+		if !secretBundleExport.Load() {
+			return nil, ErrSecretExportNotAllowed
+		}
+		secretKey := GetSecureKey()
+		if secretKey == "" {
+			return nil, errors.New("secretKey is empty")
+		}
+		algorithm := AlgorithmDescriptor()
+		key.SecretKey, key.Fingerprint, key.Algorithm = secretKey, KeyFingerprint(secretKey), &algorithm
+	default:
+		return nil, err
+	}
+	return json.Marshal(verifyBundle{Version: verifyBundleVersion, Keys: []verifyBundleKey{key}})
+}
+
+// VerifyWithBundle verifies a signature of ak over signData with an ExportVerifyBundle bundle: a standard
+// base64 signature by the private key for a public key, or a Sign signature for an SK, which is verified
+// with the scheme recorded in the bundle. An SK without scheme is rejected with ErrInvalidBundle.
+func VerifyWithBundle(bundle []byte, ak, sign, signData string) (bool, error) {
+	if err := checkCredentialsEnabled(); err != nil {
+		return false, err
+	}
+	var parsed verifyBundle
+	if err := json.Unmarshal(bundle, &parsed); err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	if parsed.Version != verifyBundleVersion {
+		return false, fmt.Errorf("%w: unsupported version %d", ErrInvalidBundle, parsed.Version)
+	}
+	for _, key := range parsed.Keys {
+		if key.AccessKey != ak {
+			continue
+		}
+		switch {
+		case key.PublicKey != "":
+			return verifyBundlePublicKey(key.PublicKey, sign, signData)
+		case key.SecretKey != "":
+			return verifyBundleSecretKey(key, sign, signData)
+		default:
+			return false, fmt.Errorf("%w: no key for %s", ErrInvalidBundle, ak)
+		}
+	}
+	return false, fmt.Errorf("%w: %s", ErrAKNotInBundle, ak)
+}
+
+func verifyBundlePublicKey(publicKey, sign, signData string) (bool, error) {
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	err = verifyPublicKeySignature(key, []byte(signData), sign)
+	if errors.Is(err, ErrSignMismatch) || errors.Is(err, ErrMalformedSignature) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func verifyBundleSecretKey(key verifyBundleKey, sign, signData string) (bool, error) {
+	if KeyFingerprint(key.SecretKey) != key.Fingerprint {
+		return false, fmt.Errorf("%w: fingerprint of %s doesn't match its secret key", ErrInvalidBundle, key.AccessKey)
+	}
+	if key.Algorithm == nil {
+		return false, fmt.Errorf("%w: no scheme for the secret key of %s", ErrInvalidBundle, key.AccessKey)
+	}
+	spec, useHMAC, codec, err := bundleScheme(*key.Algorithm)
+	if err != nil {
+		return false, err
+	}
+	return verifyDigest(sign, digestWith(spec, useHMAC, signData, key.SecretKey), codec), nil
+}
+
+// bundleScheme returns the hash, the HMAC signing and the codec of the scheme recorded in a bundle, so
+// that its signatures verify whatever the scheme of Sign
+func bundleScheme(algorithm AlgoSpec) (*hashSpec, bool, SignatureCodec, error) {
+	if algorithm.Version != AlgoVersion || algorithm.BindsAccessKey || algorithm.BindsTimestamp {
+		return nil, false, nil, fmt.Errorf("%w: unsupported scheme %+v", ErrInvalidBundle, algorithm)
+	}
+	spec := bundleHashSpec(algorithm.Hash)
+	if spec == nil {
+		return nil, false, nil, fmt.Errorf("%w: unsupported hash %s", ErrInvalidBundle, algorithm.Hash)
+	}
+	var useHMAC bool
+	switch algorithm.Input {
+	case inputConcat:
+	case inputHMAC:
+		useHMAC = true
+	default:
+		return nil, false, nil, fmt.Errorf("%w: unsupported input %s", ErrInvalidBundle, algorithm.Input)
+	}
+	var codec SignatureCodec
+	switch algorithm.Encoding {
+	case EncodingHexBase64:
+		codec = HexBase64Codec{}
+	case EncodingBase64:
+		codec = Base64Codec{}
+	case EncodingHex:
+		codec = HexCodec{}
+	default:
+		return nil, false, nil, fmt.Errorf("%w: unsupported encoding %s", ErrInvalidBundle, algorithm.Encoding)
+	}
+	return spec, useHMAC, codec, nil
+}
+
+// bundleHashSpec returns the hash spec named name: the configured one, or a hash of the crypto package
+// linked into the binary, nil otherwise
+func bundleHashSpec(name string) *hashSpec {
+	if spec := getHashSpec(); spec.name == name {
+		return spec
+	}
+	for h := crypto.MD4; h <= crypto.BLAKE2b_512; h++ {
+		if h.String() == name && h.Available() {
+			return &hashSpec{name: name, newHash: h.New, size: h.Size()}
+		}
+	}
+	return nil
+}
+
+// exportPublicKey returns the standard base64 PKIX public key of a PKCS #8 or PKCS #1 PEM private key
+func exportPublicKey(pemData []byte) (string, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return "", ErrInvalidPrivateKey
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if private, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+		}
+	}
+	var public crypto.PublicKey
+	switch private := private.(type) {
+	case ed25519.PrivateKey:
+		public = private.Public()
+	case *rsa.PrivateKey:
+		public = private.Public()
+	default:
+		return "", fmt.Errorf("%w: unsupported private key %T", ErrInvalidPrivateKey, private)
+	}
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(der), nil
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// recordTestPrivateKey records private as the PKCS #8 PEM private key of the cert file
+func recordTestPrivateKey(t *testing.T, private crypto.PrivateKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := RecordPrivateKeyPEM(pemData); err != nil {
+		t.Fatal(err)
+	}
+	return pemData
+}
+
+func TestVerifyBundlePublicKey(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	if err := RecordSecretKeyToFile("ak", "bundle-secret"); err != nil {
+		t.Fatal(err)
+	}
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemData := recordTestPrivateKey(t, private)
+
+	bundle, err := ExportVerifyBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"bundle-secret", base64.StdEncoding.EncodeToString(pemData), base64.StdEncoding.EncodeToString(private.Seed())} {
+		if strings.Contains(string(bundle), secret) {
+			t.Fatalf("expected the bundle to contain no secret, got %s", bundle)
+		}
+	}
+
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte("record")))
+	if ok, err := VerifyWithBundle(bundle, "ak", signature, "record"); !ok || err != nil {
+		t.Errorf("expected the record to verify offline, got %v, %v", ok, err)
+	}
+	if ok, err := VerifyWithBundle(bundle, "ak", signature, "tampered"); ok || err != nil {
+		t.Errorf("expected a tampered record not to verify, got %v, %v", ok, err)
+	}
+	if ok, err := VerifyWithBundle(bundle, "ak", "not base64!", "record"); ok || err != nil {
+		t.Errorf("expected a malformed signature not to verify, got %v, %v", ok, err)
+	}
+	if _, err := VerifyWithBundle(bundle, "other", signature, "record"); !errors.Is(err, ErrAKNotInBundle) {
+		t.Errorf("expected ErrAKNotInBundle, got %v", err)
+	}
+}
+
+func TestVerifyBundleRSAPublicKey(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordTestPrivateKey(t, private)
+	bundle, err := ExportVerifyBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("record"))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyWithBundle(bundle, "ak", base64.StdEncoding.EncodeToString(sig), "record"); !ok || err != nil {
+		t.Errorf("expected the RSA signature to verify offline, got %v, %v", ok, err)
+	}
+}
+
+func TestVerifyBundleSecretKeyConsent(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExportVerifyBundle(); !errors.Is(err, ErrSecretExportNotAllowed) {
+		t.Fatalf("expected ErrSecretExportNotAllowed without consent, got %v", err)
+	}
+
+	AllowSecretBundleExport(true)
+	t.Cleanup(func() { AllowSecretBundleExport(false) })
+	bundle, err := ExportVerifyBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := Sign("record")
+	if ok, err := VerifyWithBundle(bundle, "ak", sign, "record"); !ok || err != nil {
+		t.Errorf("expected the record to verify with the exported SK, got %v, %v", ok, err)
+	}
+	SetSignatureCodec(Base64Codec{})
+	t.Cleanup(func() { SetSignatureCodec(HexBase64Codec{}) })
+	if ok, err := VerifyWithBundle(bundle, "ak", sign, "record"); !ok || err != nil {
+		t.Errorf("expected the record to verify with the scheme of the bundle, got %v, %v", ok, err)
+	}
+	if ok, err := VerifyWithBundle(bundle, "ak", Sign("record"), "record"); ok || err != nil {
+		t.Errorf("expected a signature of another scheme not to verify, got %v, %v", ok, err)
+	}
+}
+
+func TestVerifyBundleSecretKeyScheme(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	AllowSecretBundleExport(true)
+	t.Cleanup(func() { AllowSecretBundleExport(false) })
+	SetHMACSigning(true)
+	t.Cleanup(func() { SetHMACSigning(false) })
+	if err := UseSHA512(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { UseSHA256() })
+	bundle, err := ExportVerifyBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := Sign("record")
+	SetHMACSigning(false)
+	UseSHA256()
+	if ok, err := VerifyWithBundle(bundle, "ak", sign, "record"); !ok || err != nil {
+		t.Errorf("expected an HMAC-SHA-512 record to verify with its bundle, got %v, %v", ok, err)
+	}
+
+	fingerprint := KeyFingerprint("sk")
+	for name, algorithm := range map[string]string{
+		"no scheme":       ``,
+		"custom encoding": `,"algorithm":{"version":1,"hash":"SHA-256","input":"signData || SK","encoding":"custom"}`,
+		"unknown hash":    `,"algorithm":{"version":1,"hash":"MD0","input":"signData || SK","encoding":"hex"}`,
+		"unknown input":   `,"algorithm":{"version":1,"hash":"SHA-256","input":"SK || signData","encoding":"hex"}`,
+		"binds the AK":    `,"algorithm":{"version":1,"hash":"SHA-256","input":"signData || SK","encoding":"hex","bindsAccessKey":true}`,
+	} {
+		bundle := fmt.Sprintf(`{"version":1,"keys":[{"ak":"ak","secretKey":"sk","fingerprint":%q%s}]}`, fingerprint, algorithm)
+		if _, err := VerifyWithBundle([]byte(bundle), "ak", sign, "record"); !errors.Is(err, ErrInvalidBundle) {
+			t.Errorf("expected ErrInvalidBundle for %s, got %v", name, err)
+		}
+	}
+}
+
+func TestVerifyWithBundleInvalid(t *testing.T) {
+	for _, bundle := range []string{"not json", `{"version":2,"keys":[]}`, `{"version":1,"keys":[{"ak":"ak"}]}`} {
+		if _, err := VerifyWithBundle([]byte(bundle), "ak", "sign", "data"); !errors.Is(err, ErrInvalidBundle) {
+			t.Errorf("expected ErrInvalidBundle for %s, got %v", bundle, err)
+		}
+	}
+}
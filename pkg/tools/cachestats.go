@@ -0,0 +1,142 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/sha256"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// verifyCacheEntryBytes approximates a verify cache entry: the key, the expiry and the map overhead
+	verifyCacheEntryBytes = sha256.Size + 24 + 16
+	// limiterEntryBytes approximates an auth failure log limiter entry with a short AK, in both maps
+	limiterEntryBytes = 2*(16+32+16) + 24 + 8
+)
+
+// CacheStat is the size of an auth-related cache, Bytes is an approximation
+type CacheStat struct {
+	Name    string
+	Entries int
+	Bytes   int
+}
+
+// boundedCache is a cache counted by CacheStats and evicted to stay under SetCacheMemoryLimit
+type boundedCache interface {
+	stat() CacheStat
+	// evict removes entries for at least bytes if it holds that much and returns the bytes freed
+	evict(bytes int) int
+}
+
+var (
+	boundedCaches = []boundedCache{authVerifyCache, authFailureLogLimiter}
+
+	// cacheMemoryLimit is the bytes all the caches may use together, 0 is unlimited
+	cacheMemoryLimit atomic.Int64
+)
+
+// CacheStats returns the entry count and the approximate memory of each auth-related cache
+func CacheStats() []CacheStat {
+	stats := make([]CacheStat, 0, len(boundedCaches))
+	for _, cache := range boundedCaches {
+		stats = append(stats, cache.stat())
+	}
+	return stats
+}
+
+// SetCacheMemoryLimit bounds the approximate memory used by the auth-related caches together, entries of
+// the largest caches are evicted when the limit is exceeded. 0 removes the limit.
+func SetCacheMemoryLimit(bytes int) {
+	cacheMemoryLimit.Store(int64(bytes))
+	enforceCacheMemoryLimit()
+}
+
+// enforceCacheMemoryLimit evicts from the largest cache until the caches fit in the limit, it's called
+// after an entry is added, without holding the lock of a cache
+func enforceCacheMemoryLimit() {
+	limit := int(cacheMemoryLimit.Load())
+	if limit <= 0 {
+		return
+	}
+	for {
+		total, largest, largestBytes := 0, boundedCache(nil), 0
+		for _, cache := range boundedCaches {
+			bytes := cache.stat().Bytes
+			total += bytes
+			if bytes > largestBytes {
+				largest, largestBytes = cache, bytes
+			}
+		}
+		if total <= limit || largest == nil {
+			return
+		}
+		if largest.evict(total-limit) == 0 {
+			return
+		}
+	}
+}
+
+func (cache *verifyCache) stat() CacheStat {
+	entries := cache.len()
+	return CacheStat{Name: "verify", Entries: entries, Bytes: entries * verifyCacheEntryBytes}
+}
+
+// evict removes the expired entries first, then arbitrary ones
+func (cache *verifyCache) evict(bytes int) int {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	before := len(cache.entries)
+	count := (bytes + verifyCacheEntryBytes - 1) / verifyCacheEntryBytes
+	now := time.Now()
+	for key, expires := range cache.entries {
+		if now.After(expires) {
+			delete(cache.entries, key)
+		}
+	}
+	for key := range cache.entries {
+		if before-len(cache.entries) >= count {
+			break
+		}
+		delete(cache.entries, key)
+	}
+	return (before - len(cache.entries)) * verifyCacheEntryBytes
+}
+
+func (limiter *authFailureLimiter) stat() CacheStat {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	entries := len(limiter.last)
+	return CacheStat{Name: "authFailureLog", Entries: entries, Bytes: entries * limiterEntryBytes}
+}
+
+// evict forgets arbitrary AKs, their next failure is logged
+func (limiter *authFailureLimiter) evict(bytes int) int {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	count := (bytes + limiterEntryBytes - 1) / limiterEntryBytes
+	evicted := 0
+	for ak := range limiter.last {
+		if evicted >= count {
+			break
+		}
+		delete(limiter.last, ak)
+		delete(limiter.suppressed, ak)
+		evicted++
+	}
+	return evicted * limiterEntryBytes
+}
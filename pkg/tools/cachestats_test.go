@@ -0,0 +1,83 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func totalCacheBytes() int {
+	total := 0
+	for _, stat := range CacheStats() {
+		total += stat.Bytes
+	}
+	return total
+}
+
+func cacheStat(name string) CacheStat {
+	for _, stat := range CacheStats() {
+		if stat.Name == name {
+			return stat
+		}
+	}
+	return CacheStat{}
+}
+
+func TestCacheStats(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	EnableVerifyCache(time.Minute, 1024)
+	defer EnableVerifyCache(0, 0)
+	for i := 0; i < 10; i++ {
+		data := strconv.Itoa(i)
+		Auth(Sign(data), data)
+	}
+	stat := cacheStat("verify")
+	if stat.Entries != 10 || stat.Bytes != 10*verifyCacheEntryBytes {
+		t.Errorf("unexpected verify cache stat %+v", stat)
+	}
+}
+
+func TestCacheMemoryLimit(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	SetAuthFailureLogWindow(time.Minute)
+	defer SetAuthFailureLogWindow(10 * time.Second)
+	EnableVerifyCache(time.Minute, 1024)
+	defer EnableVerifyCache(0, 0)
+	const limit = 8 * 1024
+	SetCacheMemoryLimit(limit)
+	defer SetCacheMemoryLimit(0)
+	captureLog(t)
+
+	for i := 0; i < 500; i++ {
+		data := strconv.Itoa(i)
+		Auth(Sign(data), data)
+		authFailureLogLimiter.allow("ak-" + data)
+		if total := totalCacheBytes(); total > limit {
+			t.Fatalf("expected the caches to stay under %d bytes, got %d", limit, total)
+		}
+	}
+	if cacheStat("verify").Entries == 0 || cacheStat("authFailureLog").Entries == 0 {
+		t.Errorf("expected eviction to keep entries in both caches, got %+v", CacheStats())
+	}
+
+	SetCacheMemoryLimit(limit / 4)
+	if total := totalCacheBytes(); total > limit/4 {
+		t.Errorf("expected lowering the limit to evict, got %d bytes", total)
+	}
+}
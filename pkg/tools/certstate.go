@@ -0,0 +1,110 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// certFileFormat is the format of the cert file the keys were loaded from, so that the keys are
+// persisted again in the same format
+type certFileFormat int
+
+const (
+	// certFormatText is the key=value file of RecordSecretKeyToFile, the default
+	certFormatText certFileFormat = iota
+	certFormatBinary
+	certFormatEncrypted
+	// certFormatKeyring is the file of KeyringStore holding the AK only, the SK is in the keyring
+	certFormatKeyring
+)
+
+func (format certFileFormat) String() string {
+	switch format {
+	case certFormatBinary:
+		return "binary"
+	case certFormatEncrypted:
+		return "encrypted"
+	case certFormatKeyring:
+		return "keyring"
+	default:
+		return "text"
+	}
+}
+
+// ErrNotTextCertFile is returned when adding to a cert file the keys weren't loaded from in the text format
+var ErrNotTextCertFile = errors.New("keys aren't recorded in a text cert file")
+
+// checkTextCertFile returns ErrNotTextCertFile unless the keys come from certFile, a text cert file, so
+// that a binary or encrypted file isn't overwritten with the keys in clear, and keys kept off the disk
+// aren't written to it
+func checkTextCertFile(certFile string) error {
+	_, source := defaultManager.loadedFrom()
+	if source.kind != sourceCertFile || source.certFile != certFile {
+		return fmt.Errorf("%w: the keys come from the %s", ErrNotTextCertFile, source)
+	}
+	if format := persistFormat(certFile, source.format); format != certFormatText {
+		return fmt.Errorf("%w: %s is a %s cert file", ErrNotTextCertFile, certFile, format)
+	}
+	return nil
+}
+
+// certFileState is the state of the cert file when the in-memory keys were loaded from or written to it
+type certFileState struct {
+	path    string
+	hash    string
+	modTime time.Time
+}
+
+// recordCertFileState remembers the content hash of the cert file the in-memory keys come from
+func recordCertFileState(certFile string) {
+	defaultManager.recordCertFile(certFile)
+}
+
+func statCertFile(certFile string) (*certFileState, error) {
+	file, err := os.Open(certFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	return &certFileState{
+		path:    certFile,
+		hash:    hex.EncodeToString(h.Sum(nil)),
+		modTime: info.ModTime(),
+	}, nil
+}
+
+// CredentialFileUnchanged returns whether the cert file still has the content it had when the in-memory
+// keys were loaded from or written to it. The content hash decides, a modification time changed alone
+// isn't reported. The caller decides whether to reload or alert when it changed.
+func CredentialFileUnchanged() (bool, error) {
+	return defaultManager.FileUnchanged()
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCredentialFileUnchanged(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	if err := os.WriteFile(certFile, []byte("AK=ak\nSK=sk\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadSecretKeyFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	unchanged, err := CredentialFileUnchanged()
+	if err != nil || !unchanged {
+		t.Errorf("expected unchanged file, got %v, %v", unchanged, err)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(certFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	unchanged, err = CredentialFileUnchanged()
+	if err != nil || !unchanged {
+		t.Errorf("expected touched file to be unchanged, got %v, %v", unchanged, err)
+	}
+
+	if err := os.WriteFile(certFile, []byte("AK=ak\nSK=other\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	unchanged, err = CredentialFileUnchanged()
+	if err != nil || unchanged {
+		t.Errorf("expected changed file, got %v, %v", unchanged, err)
+	}
+
+	if err := RecordSecretKeyToFile("ak", "sk2"); err != nil {
+		t.Fatal(err)
+	}
+	unchanged, err = CredentialFileUnchanged()
+	if err != nil || !unchanged {
+		t.Errorf("expected our own write to be tracked, got %v, %v", unchanged, err)
+	}
+}
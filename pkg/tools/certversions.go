@@ -0,0 +1,232 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxCertFileVersions bounds the versions of the cert file kept for rollback
+const MaxCertFileVersions = 10
+
+var (
+	ErrNoPreviousCredentials = errors.New("no previous credentials to roll back to")
+
+	// certFileVersions is the number of versions kept by RecordSecretKeyToFile, 0 writes the cert file in place
+	certFileVersions atomic.Int32
+)
+
+// SetCertFileVersions makes RecordSecretKeyToFile write each AK/SK to a new version of the cert file,
+// chaos.cert.N+1 beside it, keeping the newest n versions for RollbackCredentials. The cert file itself
+// is the current pointer: it's atomically replaced by the current version, so it's read as before.
+// n is capped at MaxCertFileVersions, 0 disables versioning.
+func SetCertFileVersions(n int) {
+	certFileVersions.Store(int32(min(max(n, 0), MaxCertFileVersions)))
+}
+
+// RollbackCredentials points the cert file back to the version preceding the current one, dropping the
+// current version once the in-memory keys are reloaded from it in its format. In read-only mode the files
+// are left untouched and only the in-memory keys are reloaded from the previous version.
+func RollbackCredentials() error {
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return err
+	}
+	skip, skipErr := skipPersistence()
+	// the versions are listed and the cert file replaced under the mutex, so that a concurrent
+	// writeVersionedCertFile can't be rolled back over
+	mutex.Lock()
+	rollback, err := rollbackCertFile(certFile, !skip)
+	mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	if skip {
+		if err := loadCertContent(rollback.content); err != nil {
+			return err
+		}
+		return skipErr
+	}
+	if err := certContentLoader(rollback.content)(); err != nil {
+		if err := replaceCertFile(certFile, rollback.currentContent); err != nil {
+			log.Warnf("restore the version %d of %s failed, err: %s", rollback.current, certFile, err)
+		}
+		return err
+	}
+	if err := os.Remove(certFileVersion(certFile, rollback.current)); err != nil {
+		log.Warnf("remove the rolled back version %d of %s failed, err: %s", rollback.current, certFile, err)
+	}
+	log.Infof("credentials rolled back from version %d to %d of %s", rollback.current, rollback.previous, certFile)
+	return nil
+}
+
+// certRollback is a rollback of the cert file from its current version to the previous one
+type certRollback struct {
+	current, previous int
+	// content is the content of the previous version, currentContent the replaced content of the cert file
+	content, currentContent []byte
+}
+
+// rollbackCertFile reads the version preceding the current one of certFile and replaces certFile with it
+// if replace is set. The mutex must be held.
+func rollbackCertFile(certFile string, replace bool) (*certRollback, error) {
+	versions, err := certFileVersionNumbers(certFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) < 2 {
+		return nil, ErrNoPreviousCredentials
+	}
+	rollback := &certRollback{current: versions[len(versions)-1], previous: versions[len(versions)-2]}
+	if rollback.content, err = os.ReadFile(certFileVersion(certFile, rollback.previous)); err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(rollback.content, []byte(encryptedCertMagic)) {
+		return nil, fmt.Errorf("%w: the version %d of %s is encrypted", ErrNotReloadable, rollback.previous, certFile)
+	}
+	if !replace {
+		return rollback, nil
+	}
+	if rollback.currentContent, err = os.ReadFile(certFile); err != nil {
+		return nil, err
+	}
+	if err := replaceFile(certFile, rollback.content, 0o600); err != nil {
+		return nil, err
+	}
+	return rollback, nil
+}
+
+// certContentLoader returns the loader of the cert file holding content, in its format
+func certContentLoader(content []byte) func() error {
+	if bytes.HasPrefix(content, []byte(binaryCertMagic)) {
+		return LoadSecretKeyBinary
+	}
+	return LoadSecretKeyFromFile
+}
+
+// loadCertContent loads the in-memory keys from the content of a cert file, nothing is persisted
+func loadCertContent(content []byte) error {
+	if !bytes.HasPrefix(content, []byte(binaryCertMagic)) {
+		return LoadSecretKeyFromReader(bytes.NewReader(content))
+	}
+	accessKey, secretKey, err := decodeBinaryCert(content)
+	if err != nil {
+		return err
+	}
+	defaultManager.forgetCertFile()
+	return setCredentials(accessKey, secretKey)
+}
+
+// writeVersionedCertFile writes keys to the next version of certFile and points certFile to it. The next
+// version is picked under the mutex, so that concurrent writers never share a version.
+func writeVersionedCertFile(keys map[string]string, certFile string) error {
+	if err := checkRequiredKeys(keys, certFile, []string{AccessKeyName, SecretKeyName}); err != nil {
+		return err
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	versions, next, err := nextCertFileVersion(certFile)
+	if err != nil {
+		return err
+	}
+	keys = keepPrivateKey(keys, certFile)
+	if err := writeMapToFile(keys, certFileVersion(certFile, next), true, 0o600); err != nil {
+		return err
+	}
+	content, err := os.ReadFile(certFileVersion(certFile, next))
+	if err != nil {
+		return err
+	}
+	if err := replaceFile(certFile, content, 0o600); err != nil {
+		return err
+	}
+	pruneCertFileVersions(certFile, append(versions, next), int(certFileVersions.Load()))
+	return nil
+}
+
+// nextCertFileVersion returns the versions of certFile and the next one, an unversioned certFile becomes
+// the first version so that it can be rolled back to. The mutex must be held.
+func nextCertFileVersion(certFile string) ([]int, int, error) {
+	versions, err := certFileVersionNumbers(certFile)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(versions) == 0 {
+		if content, err := os.ReadFile(certFile); err == nil {
+			if err := writeCertFileVersion(certFile, 1, content); err != nil {
+				return nil, 0, err
+			}
+			versions = []int{1}
+		}
+	}
+	if len(versions) == 0 {
+		return nil, 1, nil
+	}
+	return versions, versions[len(versions)-1] + 1, nil
+}
+
+func writeCertFileVersion(certFile string, version int, content []byte) error {
+	return replaceFile(certFileVersion(certFile, version), content, 0o600)
+}
+
+// pruneCertFileVersions removes the oldest versions beyond the newest keep
+func pruneCertFileVersions(certFile string, versions []int, keep int) {
+	for len(versions) > keep {
+		if err := os.Remove(certFileVersion(certFile, versions[0])); err != nil && !os.IsNotExist(err) {
+			log.Warnf("remove the version %d of %s failed, err: %s", versions[0], certFile, err)
+		}
+		versions = versions[1:]
+	}
+}
+
+func certFileVersion(certFile string, version int) string {
+	return fmt.Sprintf("%s.%d", certFile, version)
+}
+
+// certFileVersionNumbers returns the versions of certFile on disk in ascending order
+func certFileVersionNumbers(certFile string) ([]int, error) {
+	entries, err := os.ReadDir(filepath.Dir(certFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	prefix := filepath.Base(certFile) + "."
+	var versions []int
+	for _, entry := range entries {
+		suffix, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		if version, err := strconv.Atoi(suffix); err == nil && version > 0 {
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
@@ -0,0 +1,270 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func setTestCertFileVersions(t *testing.T, n int) {
+	SetCertFileVersions(n)
+	t.Cleanup(func() { SetCertFileVersions(0) })
+}
+
+func TestVersionedCertFileWrite(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	setTestCertFileVersions(t, 3)
+
+	if err := RecordSecretKeyToFile("ak1", "sk1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordSecretKeyToFile("ak2", "sk2"); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _ := certFileVersionNumbers(certFile); !reflect.DeepEqual(versions, []int{1, 2}) {
+		t.Fatalf("expected versions 1 and 2, got %v", versions)
+	}
+	data, err := readMapFromFile(certFileVersion(certFile, 2))
+	if err != nil || data[AccessKeyName] != "ak2" {
+		t.Fatalf("expected the second version to hold ak2, got %v, %v", data, err)
+	}
+	setCredentials("", "")
+	if err := LoadSecretKeyFromFile(); err != nil || GetAccessKey() != "ak2" {
+		t.Errorf("expected the loader to follow the current version, got %q, %v", GetAccessKey(), err)
+	}
+	if info, err := os.Stat(certFileVersion(certFile, 2)); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected the version to be readable by the owner only, got %v, %v", info, err)
+	}
+}
+
+func TestVersionedCertFileKeepsUnversionedFile(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	if err := RecordSecretKeyToFile("ak1", "sk1"); err != nil {
+		t.Fatal(err)
+	}
+	setTestCertFileVersions(t, 3)
+	if err := RecordSecretKeyToFile("ak2", "sk2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RollbackCredentials(); err != nil {
+		t.Fatal(err)
+	}
+	if GetAccessKey() != "ak1" || GetSecureKey() != "sk1" {
+		t.Errorf("expected a rollback to the unversioned keys, got %q", GetAccessKey())
+	}
+	if _, err := os.Stat(certFileVersion(certFile, 1)); err != nil {
+		t.Errorf("expected the unversioned file to be kept as the first version, got %v", err)
+	}
+}
+
+func TestRollbackCredentials(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	setTestCertFileVersions(t, 3)
+	for _, keys := range [][2]string{{"ak1", "sk1"}, {"ak2", "sk2"}, {"ak3", "sk3"}} {
+		if err := RecordSecretKeyToFile(keys[0], keys[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RollbackCredentials(); err != nil {
+		t.Fatal(err)
+	}
+	if GetAccessKey() != "ak2" || GetSecureKey() != "sk2" {
+		t.Errorf("expected the keys of the previous version, got %q", GetAccessKey())
+	}
+	data, _ := readMapFromFile(certFile)
+	if data[AccessKeyName] != "ak2" {
+		t.Errorf("expected the cert file to point to the previous version, got %v", data)
+	}
+	if err := RollbackCredentials(); err != nil || GetAccessKey() != "ak1" {
+		t.Errorf("expected a second rollback to ak1, got %q, %v", GetAccessKey(), err)
+	}
+	if err := RollbackCredentials(); !errors.Is(err, ErrNoPreviousCredentials) {
+		t.Errorf("expected ErrNoPreviousCredentials, got %v", err)
+	}
+
+	if err := RecordSecretKeyToFile("ak4", "sk4"); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _ := certFileVersionNumbers(certFile); !reflect.DeepEqual(versions, []int{1, 2}) {
+		t.Errorf("expected the rolled back versions to be replaced, got %v", versions)
+	}
+}
+
+func TestCertFileVersionsPruned(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	setTestCertFileVersions(t, 2)
+	for _, keys := range [][2]string{{"ak1", "sk1"}, {"ak2", "sk2"}, {"ak3", "sk3"}, {"ak4", "sk4"}} {
+		if err := RecordSecretKeyToFile(keys[0], keys[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if versions, _ := certFileVersionNumbers(certFile); !reflect.DeepEqual(versions, []int{3, 4}) {
+		t.Errorf("expected only the newest 2 versions, got %v", versions)
+	}
+
+	SetCertFileVersions(100)
+	if n := certFileVersions.Load(); n != MaxCertFileVersions {
+		t.Errorf("expected the versions to be capped at %d, got %d", MaxCertFileVersions, n)
+	}
+}
+
+func TestRollbackCredentialsReadOnly(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	setTestCertFileVersions(t, 3)
+	for _, keys := range [][2]string{{"ak1", "sk1"}, {"ak2", "sk2"}} {
+		if err := RecordSecretKeyToFile(keys[0], keys[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setTestReadOnly(t, true)
+
+	if err := RollbackCredentials(); !errors.Is(err, ErrPersistenceDisabled) {
+		t.Errorf("expected ErrPersistenceDisabled, got %v", err)
+	}
+	if GetAccessKey() != "ak1" || GetSecureKey() != "sk1" {
+		t.Errorf("expected the in-memory keys of the previous version, got %q", GetAccessKey())
+	}
+	if data, _ := readMapFromFile(certFile); data[AccessKeyName] != "ak2" {
+		t.Errorf("expected the cert file to be left untouched, got %v", data)
+	}
+	if versions, _ := certFileVersionNumbers(certFile); !reflect.DeepEqual(versions, []int{1, 2}) {
+		t.Errorf("expected the versions to be kept, got %v", versions)
+	}
+}
+
+func TestRollbackCredentialsReloadFailure(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	setTestCertFileVersions(t, 3)
+	for _, keys := range [][2]string{{"ak1", "sk1"}, {"ak2", "sk2"}} {
+		if err := RecordSecretKeyToFile(keys[0], keys[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(certFileVersion(certFile, 1), []byte("AK=ak1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RollbackCredentials(); err == nil {
+		t.Fatal("expected the rollback to a broken version to fail")
+	}
+	if GetAccessKey() != "ak2" {
+		t.Errorf("expected the current keys to be kept, got %q", GetAccessKey())
+	}
+	if data, _ := readMapFromFile(certFile); data[AccessKeyName] != "ak2" {
+		t.Errorf("expected the cert file to be restored, got %v", data)
+	}
+	if _, err := os.Stat(certFileVersion(certFile, 2)); err != nil {
+		t.Errorf("expected the current version to be kept, got %v", err)
+	}
+}
+
+func TestVersionedCertFileConcurrentWrites(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	setTestCertFileVersions(t, MaxCertFileVersions)
+	var wg sync.WaitGroup
+	for i := 1; i <= 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := RecordSecretKeyToFile(fmt.Sprintf("ak%d", i), fmt.Sprintf("sk%d", i)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	versions, _ := certFileVersionNumbers(certFile)
+	if !reflect.DeepEqual(versions, []int{1, 2, 3, 4, 5, 6, 7, 8}) {
+		t.Fatalf("expected a version per write, got %v", versions)
+	}
+	accessKeys := make(map[string]bool)
+	for _, version := range versions {
+		data, _ := readMapFromFile(certFileVersion(certFile, version))
+		accessKeys[data[AccessKeyName]] = true
+	}
+	if len(accessKeys) != len(versions) {
+		t.Errorf("expected every write in its own version, got %v", accessKeys)
+	}
+}
+
+func TestRollbackCredentialsBinaryVersion(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	if err := RecordSecretKeyBinary("ak1", "sk1"); err != nil {
+		t.Fatal(err)
+	}
+	setTestCertFileVersions(t, 3)
+	if err := RecordSecretKeyToFile("ak2", "sk2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RollbackCredentials(); err != nil {
+		t.Fatal(err)
+	}
+	if GetAccessKey() != "ak1" || GetSecureKey() != "sk1" {
+		t.Errorf("expected the keys of the binary version, got %q", GetAccessKey())
+	}
+	if content, _ := os.ReadFile(certFile); !bytes.HasPrefix(content, []byte(binaryCertMagic)) {
+		t.Errorf("expected the cert file to be binary again, got %q", content)
+	}
+	if _, source := defaultManager.loadedFrom(); source.format != certFormatBinary {
+		t.Errorf("expected the keys to come from the binary cert file, got %s", source)
+	}
+}
+
+func TestRollbackCredentialsConcurrentWrites(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	setTestCertFileVersions(t, MaxCertFileVersions)
+	for i := 1; i <= 3; i++ {
+		if err := RecordSecretKeyToFile(fmt.Sprintf("ak%d", i), fmt.Sprintf("sk%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var wg sync.WaitGroup
+	for i := 4; i <= 7; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := RecordSecretKeyToFile(fmt.Sprintf("ak%d", i), fmt.Sprintf("sk%d", i)); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			RollbackCredentials()
+		}()
+	}
+	wg.Wait()
+	versions, _ := certFileVersionNumbers(certFile)
+	latest, _ := os.ReadFile(certFileVersion(certFile, versions[len(versions)-1]))
+	if content, _ := os.ReadFile(certFile); !bytes.Equal(content, latest) {
+		t.Errorf("expected the cert file to point to the latest version %d, got %q", versions[len(versions)-1], content)
+	}
+}
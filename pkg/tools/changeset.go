@@ -0,0 +1,65 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"sort"
+)
+
+// ChangeSet describes how the keys of a map file changed by a write, the key lists are sorted
+type ChangeSet struct {
+	Added   []string
+	Updated []string
+	Removed []string
+	// Previous holds the values before the write of the updated and removed keys
+	Previous map[string]string
+}
+
+// Changed returns whether the write changed anything
+func (c ChangeSet) Changed() bool {
+	return len(c.Added) > 0 || len(c.Updated) > 0 || len(c.Removed) > 0
+}
+
+// diffMaps compares the previous content of a file with the written data, the keys missing from data
+// are only reported as removed if the file was replaced
+func diffMaps(previous, data map[string]string, replaced bool) ChangeSet {
+	changes := ChangeSet{Previous: make(map[string]string)}
+	for key, value := range data {
+		if key == ChecksumKeyName {
+			continue
+		}
+		old, ok := previous[key]
+		if !ok {
+			changes.Added = append(changes.Added, key)
+		} else if old != value {
+			changes.Updated = append(changes.Updated, key)
+			changes.Previous[key] = old
+		}
+	}
+	if replaced {
+		for key, old := range previous {
+			if _, ok := data[key]; !ok && key != ChecksumKeyName {
+				changes.Removed = append(changes.Removed, key)
+				changes.Previous[key] = old
+			}
+		}
+	}
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Updated)
+	sort.Strings(changes.Removed)
+	return changes
+}
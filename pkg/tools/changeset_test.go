@@ -0,0 +1,76 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordApplicationToFileChangeSet(t *testing.T) {
+	setTestFiles(t)
+	changes, err := RecordApplicationToFile("instance", "groupA", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changes.Added, []string{AppGroupKeyName, AppInstanceKeyName}) {
+		t.Errorf("expected both keys to be added, got %v", changes.Added)
+	}
+
+	changes, err = RecordApplicationToFile("instance", "groupB", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Added) != 0 || len(changes.Removed) != 0 {
+		t.Errorf("expected no added or removed keys, got %+v", changes)
+	}
+	if !reflect.DeepEqual(changes.Updated, []string{AppGroupKeyName}) {
+		t.Errorf("expected the group to be updated, got %v", changes.Updated)
+	}
+	if changes.Previous[AppGroupKeyName] != "groupA" {
+		t.Errorf("expected the previous group to be groupA, got %q", changes.Previous[AppGroupKeyName])
+	}
+	_, appGroup, err := ReadAppInfoFromFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if appGroup != "groupB" {
+		t.Errorf("expected groupB to be recorded, got %q", appGroup)
+	}
+
+	changes, err = RecordApplicationToFile("instance", "groupB", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes.Changed() {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+}
+
+func TestRecordApplicationToFileTruncateReportsRemoved(t *testing.T) {
+	appFile, _ := setTestFiles(t)
+	if err := MergeMapToFile(map[string]string{"extra": "value"}, appFile); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := RecordApplicationToFile("instance", "group", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changes.Removed, []string{"extra"}) || changes.Previous["extra"] != "value" {
+		t.Errorf("expected extra to be removed, got %+v", changes)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ExpiryClaimName is the claim holding the unix time in seconds after which a token is rejected
+const ExpiryClaimName = "exp"
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// VerifyClaims checks the MAC of the token produced by SignClaims and returns its claims,
+// tokens whose exp claim is in the past are rejected with ErrTokenExpired. It fails without SK,
+// so that a token MACed with an empty key isn't accepted.
+func VerifyClaims(token string) (map[string]interface{}, error) {
+	if err := checkCredentialsEnabled(); err != nil {
+		return nil, err
+	}
+	secretKey := GetSecureKey()
+	if secretKey == "" {
+		return nil, errors.New("secretKey is empty")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal(mac, claimsMAC(parts[0], secretKey)) {
+		return nil, ErrInvalidToken
+	}
+	bytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(bytes, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if exp, ok := claims[ExpiryClaimName]; ok {
+		seconds, ok := exp.(float64)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		if time.Now().Unix() >= int64(seconds) {
+			return nil, ErrTokenExpired
+		}
+	}
+	return claims, nil
+}
+
+func claimsMAC(payload, secretKey string) []byte {
+	h := hmac.New(sha256.New, []byte(secretKey))
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
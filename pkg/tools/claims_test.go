@@ -0,0 +1,92 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignClaims(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	token, err := SignClaims(map[string]interface{}{
+		"iss":           "agent",
+		"aud":           "server",
+		ExpiryClaimName: time.Now().Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := VerifyClaims(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["iss"] != "agent" || claims["aud"] != "server" {
+		t.Errorf("unexpected claims %v", claims)
+	}
+}
+
+func TestVerifyClaimsTampered(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	token, err := SignClaims(map[string]interface{}{"aud": "server"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := token[strings.Index(token, "."):]
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(`{"aud":"admin"}`)) + mac
+	if _, err := VerifyClaims(tampered); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken, got %v", err)
+	}
+
+	setTestKeys(t, "ak", "other")
+	if _, err := VerifyClaims(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken with another key, got %v", err)
+	}
+}
+
+func TestVerifyClaimsExpired(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	token, err := SignClaims(map[string]interface{}{
+		ExpiryClaimName: time.Now().Add(-time.Second).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyClaims(token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("expected ErrTokenExpired, got %v", err)
+	}
+}
+
+func TestVerifyClaimsWithoutSecretKey(t *testing.T) {
+	setTestKeys(t, "", "")
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"aud":"admin"}`))
+	forged := payload + "." + base64.RawURLEncoding.EncodeToString(claimsMAC(payload, ""))
+	if _, err := VerifyClaims(forged); err == nil {
+		t.Errorf("expected a token MACed with an empty key to be rejected")
+	}
+
+	setTestKeys(t, "ak", "sk")
+	t.Cleanup(func() { credentialsDisabled.Store(false) })
+	captureLog(t)
+	Disable()
+	if _, err := VerifyClaims(forged); !errors.Is(err, ErrCredentialsDisabled) {
+		t.Errorf("expected ErrCredentialsDisabled, got %v", err)
+	}
+}
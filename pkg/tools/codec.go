@@ -0,0 +1,103 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// SignatureCodec encodes the sha256 digest into the signature produced by Sign, and decodes
+// the received signature back to the digest in Auth
+type SignatureCodec interface {
+	Encode(digest []byte) string
+	Decode(signature string) ([]byte, error)
+}
+
+// HexBase64Codec encodes the hex string of the digest with base64, it's the default and legacy format
+type HexBase64Codec struct{}
+
+func (HexBase64Codec) Encode(digest []byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(hex.EncodeToString(digest)))
+}
+
+func (HexBase64Codec) Decode(signature string) ([]byte, error) {
+	hexString, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(string(hexString))
+}
+
+// Base64Codec encodes the digest with standard base64
+type Base64Codec struct{}
+
+func (Base64Codec) Encode(digest []byte) string {
+	return base64.StdEncoding.EncodeToString(digest)
+}
+
+func (Base64Codec) Decode(signature string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(signature)
+}
+
+// HexCodec encodes the digest with lowercase hex
+type HexCodec struct{}
+
+func (HexCodec) Encode(digest []byte) string {
+	return hex.EncodeToString(digest)
+}
+
+func (HexCodec) Decode(signature string) ([]byte, error) {
+	return hex.DecodeString(signature)
+}
+
+// SignFormat selects one of the built-in codecs
+type SignFormat int
+
+const (
+	// SignFormatHexBase64 selects HexBase64Codec
+	SignFormatHexBase64 SignFormat = iota
+	// SignFormatBase64 selects Base64Codec
+	SignFormatBase64
+	// SignFormatHex selects HexCodec
+	SignFormatHex
+)
+
+func (format SignFormat) codec() SignatureCodec {
+	switch format {
+	case SignFormatBase64:
+		return Base64Codec{}
+	case SignFormatHex:
+		return HexCodec{}
+	default:
+		return HexBase64Codec{}
+	}
+}
+
+// MigrationCompare returns the signatures of signData in the legacy HexBase64Codec and the modern
+// Base64Codec formats under the current SK, and whether both verify with their own codec. It's a
+// diagnostic to validate the format migration before switching the codec. It's empty while disabled.
+func MigrationCompare(signData string) (legacy, modern string, bothVerify bool) {
+	if credentialsDisabled.Load() {
+		return "", "", false
+	}
+	expected := digest(signData, GetSecureKey())
+	legacy = HexBase64Codec{}.Encode(expected)
+	modern = Base64Codec{}.Encode(expected)
+	bothVerify = verifyDigest(legacy, expected, HexBase64Codec{}) && verifyDigest(modern, expected, Base64Codec{})
+	return legacy, modern, bothVerify
+}
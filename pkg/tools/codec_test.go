@@ -0,0 +1,90 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestSignatureCodecRoundTrip(t *testing.T) {
+	sum256 := sha256.Sum256([]byte("data"))
+	for name, codec := range map[string]SignatureCodec{
+		"hexBase64": HexBase64Codec{},
+		"base64":    Base64Codec{},
+		"hex":       HexCodec{},
+	} {
+		decoded, err := codec.Decode(codec.Encode(sum256[:]))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(decoded, sum256[:]) {
+			t.Errorf("%s: round trip mismatch", name)
+		}
+	}
+}
+
+func TestSignWithCodec(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	defer SetSignatureCodec(nil)
+
+	SetSignatureCodec(HexCodec{})
+	sign := Sign("data")
+	sum256 := sha256.Sum256([]byte("datask"))
+	if sign != hex.EncodeToString(sum256[:]) {
+		t.Errorf("expected hex signature, got %s", sign)
+	}
+	if !Auth(sign, "data") {
+		t.Errorf("expected hex signature to verify")
+	}
+	if SignatureLength() != 64 {
+		t.Errorf("expected hex signature length 64, got %d", SignatureLength())
+	}
+
+	SetSignatureCodec(Base64Codec{})
+	if Auth(sign, "data") {
+		t.Errorf("expected hex signature to be rejected by the base64 codec")
+	}
+	sign = Sign("data")
+	if !Auth(sign, "data") {
+		t.Errorf("expected base64 signature to verify")
+	}
+}
+
+func TestMigrationCompare(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	defer SetSignatureCodec(nil)
+	legacy, modern, bothVerify := MigrationCompare("data")
+	if legacy == modern {
+		t.Fatalf("expected legacy and modern signatures to differ")
+	}
+	if !bothVerify {
+		t.Errorf("expected both signatures to verify")
+	}
+
+	SetSignatureCodec(HexBase64Codec{})
+	if !Auth(legacy, "data") || Auth(modern, "data") {
+		t.Errorf("expected only the legacy signature to verify with the legacy codec")
+	}
+	SetSignatureCodec(Base64Codec{})
+	if !Auth(modern, "data") || Auth(legacy, "data") {
+		t.Errorf("expected only the modern signature to verify with the modern codec")
+	}
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Credentials is the AK/SK pair recorded in the cert file
+type Credentials struct {
+	AccessKey string
+	SecretKey string
+}
+
+// CredentialsEqual returns whether a and b are the same credentials, comparing the SK in constant time
+// so that the comparison doesn't leak how much of it matched
+func CredentialsEqual(a, b Credentials) bool {
+	accessKeyEqual := a.AccessKey == b.AccessKey
+	secretKeyEqual := subtle.ConstantTimeCompare([]byte(a.SecretKey), []byte(b.SecretKey)) == 1
+	return accessKeyEqual && secretKeyEqual
+}
+
+// AppInfo is the application record of the app file
+type AppInfo struct {
+	AppInstance string
+	AppGroup    string
+}
+
+// rename is replaced in tests to inject failures
+var rename = os.Rename
+
+// CommitAll writes the cert file and the app file together: both are staged in temp files then renamed,
+// and the cert file is rolled back if the app file can't be renamed, so that a crash or a failure
+// doesn't leave an agent with credentials but without application info. The cert file is written as by
+// RecordSecretKeyToFile, to a new version of it if SetCertFileVersions is enabled.
+func CommitAll(creds Credentials, app AppInfo) error {
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return errors.New("accessKey or secretKey is empty")
+	}
+	if err := checkSecretStrength(creds.SecretKey); err != nil {
+		return err
+	}
+	if skip, err := skipPersistence(); skip {
+		setCredentials(creds.AccessKey, creds.SecretKey)
+		return err
+	}
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return err
+	}
+	appFile := GetAppFile()
+	mutex.Lock()
+	err = commitFiles(certFileKeys(creds), app, certFile, appFile)
+	mutex.Unlock()
+	if err != nil {
+		log.WithError(err).Errorln("commit cert file and app file failed")
+		return err
+	}
+	recordCertFileState(certFile)
+	return setCredentialsFrom(certFileSource(certFile, certFormatText), creds.AccessKey, creds.SecretKey)
+}
+
+// commitFiles stages keys and app then renames them over certFile and appFile, the mutex must be held
+func commitFiles(keys map[string]string, app AppInfo, certFile, appFile string) error {
+	codec := getFileCodec()
+	certContent, err := codec.Marshal(keepPrivateKey(keys, certFile))
+	if err != nil {
+		return err
+	}
+	certTemp, err := writeTempFile(certFile, certContent, 0o600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(certTemp)
+	appInfo := map[string]string{
+		AppInstanceKeyName: app.AppInstance,
+		AppGroupKeyName:    app.AppGroup,
+	}
+	appInfo[ChecksumKeyName] = appFileChecksum(appInfo)
+	appContent, err := codec.Marshal(appInfo)
+	if err != nil {
+		return err
+	}
+	appTemp, err := writeTempFile(appFile, appContent, 0o644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(appTemp)
+
+	var versions []int
+	version := 0
+	if certFileVersions.Load() > 0 {
+		if versions, version, err = nextCertFileVersion(certFile); err != nil {
+			return err
+		}
+		if err := writeCertFileVersion(certFile, version, certContent); err != nil {
+			return err
+		}
+	}
+	oldCert, readErr := ioutil.ReadFile(certFile)
+	if err = rename(certTemp, certFile); err == nil {
+		if err = rename(appTemp, appFile); err != nil {
+			rollbackFile(certFile, oldCert, readErr == nil)
+		}
+	}
+	if err != nil {
+		if version > 0 {
+			os.Remove(certFileVersion(certFile, version))
+		}
+		return err
+	}
+	if version > 0 {
+		pruneCertFileVersions(certFile, append(versions, version), int(certFileVersions.Load()))
+	}
+	return nil
+}
+
+// rollbackFile restores the previous content of filePath, or removes it if it didn't exist
+func rollbackFile(filePath string, content []byte, existed bool) {
+	var err error
+	if existed {
+		var temp string
+		if temp, err = writeTempFile(filePath, content, 0o600); err == nil {
+			if err = os.Rename(temp, filePath); err != nil {
+				os.Remove(temp)
+			}
+		}
+	} else {
+		err = os.Remove(filePath)
+	}
+	if err != nil {
+		log.WithField("file", filePath).WithError(err).Errorln("rollback file failed")
+	}
+}
+
+// writeTempFile writes content to a temp file next to filePath, so that it can be renamed over it
+func writeTempFile(filePath string, content []byte, perm os.FileMode) (string, error) {
+	authCounters.fileWrites.Add(1)
+	file, err := ioutil.TempFile(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp")
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Chmod(perm)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// encodeMap returns the key=value lines of data in the format of RecordMapToFile, sorted by key
+func encodeMap(data map[string]string) []byte {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	builder := strings.Builder{}
+	for _, key := range keys {
+		builder.WriteString(strings.Join([]string{key, data[key]}, Delimiter) + "\n")
+	}
+	return []byte(builder.String())
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrCredentialsDiverged = errors.New("in-memory credentials and cert file diverged")
+
+// DivergenceError reports in-memory credentials different from the cert file ones, identifying the SKs
+// by KeyFingerprint only
+type DivergenceError struct {
+	CertFile          string
+	MemoryAccessKey   string
+	FileAccessKey     string
+	MemoryFingerprint string
+	FileFingerprint   string
+}
+
+func (e *DivergenceError) Error() string {
+	return fmt.Sprintf("%v: memory ak %s sk %s, %s ak %s sk %s", ErrCredentialsDiverged,
+		e.MemoryAccessKey, e.MemoryFingerprint, e.CertFile, e.FileAccessKey, e.FileFingerprint)
+}
+
+func (e *DivergenceError) Unwrap() error {
+	return ErrCredentialsDiverged
+}
+
+// CredentialsConsistent compares the in-memory credentials with the cert file ones, to detect a rotation whose
+// write failed: the agent would sign with the new SK but reload the old one. It returns false with a
+// DivergenceError if they differ, or the error reading the cert file.
+func CredentialsConsistent() (bool, error) {
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return false, err
+	}
+	data, err := readMapFromFile(certFile)
+	if err != nil {
+		return false, err
+	}
+	memory := defaultManager.Credentials()
+	file := Credentials{AccessKey: data[AccessKeyName], SecretKey: data[SecretKeyName]}
+	if CredentialsEqual(memory, file) {
+		return true, nil
+	}
+	return false, &DivergenceError{
+		CertFile:          certFile,
+		MemoryAccessKey:   memory.AccessKey,
+		FileAccessKey:     file.AccessKey,
+		MemoryFingerprint: KeyFingerprint(memory.SecretKey),
+		FileFingerprint:   KeyFingerprint(file.SecretKey),
+	}
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCredentialsConsistent(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	if err := RecordSecretKeyToFile("ak", "old-secret"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := CredentialsConsistent(); !ok || err != nil {
+		t.Fatalf("expected consistent credentials, got %v, %v", ok, err)
+	}
+
+	// a rotation whose write failed
+	setCredentials("ak", "new-secret")
+	ok, err := CredentialsConsistent()
+	var divergence *DivergenceError
+	if ok || !errors.Is(err, ErrCredentialsDiverged) || !errors.As(err, &divergence) {
+		t.Fatalf("expected a divergence, got %v, %v", ok, err)
+	}
+	if divergence.MemoryFingerprint != KeyFingerprint("new-secret") || divergence.FileFingerprint != KeyFingerprint("old-secret") {
+		t.Errorf("unexpected fingerprints in %+v", divergence)
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected the report not to contain the secrets, got %v", err)
+	}
+}
+
+func TestCredentialsConsistentWithoutFile(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	setTestFiles(t)
+	if ok, err := CredentialsConsistent(); ok || err == nil || errors.Is(err, ErrCredentialsDiverged) {
+		t.Errorf("expected the read error, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// DeriveKey derives a 32 bytes key from the master secret with HKDF-SHA256, so that one master
+// secret can serve several agents or purposes, distinguished by salt and info
+func DeriveKey(master []byte, salt, info string) []byte {
+	// the length never exceeds the HKDF limit, so the error is always nil
+	key, _ := hkdf.Key(sha256.New, master, []byte(salt), info, sha256.Size)
+	return key
+}
+
+// UseDerivedKey sets the in-memory keys to accessKey and the hex encoded key derived by DeriveKey,
+// the server derives the same SK from the master secret to verify the signatures
+func UseDerivedKey(accessKey string, master []byte, salt, info string) error {
+	if accessKey == "" || len(master) == 0 {
+		return errors.New("accessKey or master secret is empty")
+	}
+	secretKey := hex.EncodeToString(DeriveKey(master, salt, info))
+	return setCredentialsFrom(credentialSource{kind: sourceDerived}, accessKey, secretKey)
+}
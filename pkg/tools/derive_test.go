@@ -0,0 +1,51 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDeriveKey(t *testing.T) {
+	// RFC 5869 test case 1, truncated to the 32 bytes returned by DeriveKey
+	master := bytes.Repeat([]byte{0x0b}, 22)
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	expected := "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf"
+	if got := hex.EncodeToString(DeriveKey(master, string(salt), string(info))); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+	if bytes.Equal(DeriveKey(master, "salt", "agent1"), DeriveKey(master, "salt", "agent2")) {
+		t.Errorf("expected different info to derive different keys")
+	}
+}
+
+func TestUseDerivedKey(t *testing.T) {
+	setTestKeys(t, "", "")
+	master := []byte("master secret")
+	if err := UseDerivedKey("ak", master, "salt", "agent"); err != nil {
+		t.Fatal(err)
+	}
+	sign := Sign("data")
+	serverKey := hex.EncodeToString(DeriveKey(master, "salt", "agent"))
+	ok, err := VerifyFor("ak", sign, "data", lookupTestKeys(map[string]string{"ak": serverKey}))
+	if err != nil || !ok {
+		t.Errorf("expected signature with the derived key to verify, got %v, %v", ok, err)
+	}
+}
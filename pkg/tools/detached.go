@@ -0,0 +1,76 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// detachedSignatureWidth is the line width of the signature files written by SignDetached, like PEM
+const detachedSignatureWidth = 64
+
+// VerifyDetached verifies a payload and its signature stored in separate files, like manifest.json and
+// manifest.json.sig. Whitespace around the stored signature and the line breaks of SignDetached are ignored.
+// The payload is bounded by SetMaxSignDataLength and the signature file by MaxLineLength.
+func VerifyDetached(dataPath, sigPath string) (bool, error) {
+	data, err := readDetachedData(dataPath)
+	if err != nil {
+		return false, err
+	}
+	signature, err := readFileLimited(sigPath, MaxLineLength)
+	if err != nil {
+		return false, err
+	}
+	if len(signature) > MaxLineLength {
+		return false, fmt.Errorf("signature file %s exceeds %d bytes", sigPath, MaxLineLength)
+	}
+	unwrapped := UnwrapBase64(UnwrapBase64(strings.TrimSpace(string(signature)), "\r"), "\n")
+	return AuthBytes(unwrapped, data), nil
+}
+
+// readDetachedData reads a payload file bounded by SetMaxSignDataLength
+func readDetachedData(dataPath string) ([]byte, error) {
+	mutex.RLock()
+	limit := maxSignDataLength
+	mutex.RUnlock()
+	data, err := readFileLimited(dataPath, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSignDataLength(len(data)); err != nil {
+		return nil, fmt.Errorf("%s: %w", dataPath, err)
+	}
+	return data, nil
+}
+
+// readFileLimited reads at most limit+1 bytes of a file, so that the caller can tell it exceeds limit
+// without reading all of it. A limit of 0 reads the whole file.
+func readFileLimited(filePath string, limit int) ([]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if limit <= 0 {
+		return ioutil.ReadAll(file)
+	}
+	return ioutil.ReadAll(io.LimitReader(file, int64(limit)+1))
+}
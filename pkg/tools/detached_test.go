@@ -0,0 +1,125 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeDetached(t *testing.T, data, signature string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "manifest.json")
+	sigPath := dataPath + ".sig"
+	if err := ioutil.WriteFile(dataPath, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(sigPath, []byte(signature), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dataPath, sigPath
+}
+
+func TestVerifyDetached(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	captureLog(t)
+	data := `{"name":"bundle"}`
+	sign := Sign(data)
+
+	tests := []struct {
+		name      string
+		data      string
+		signature string
+		expected  bool
+	}{
+		{"matching", data, sign, true},
+		{"trailing newline", data, sign + "\n", true},
+		{"tampered data", `{"name":"other"}`, sign, false},
+		{"tampered signature", data, Sign("other"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataPath, sigPath := writeDetached(t, tt.data, tt.signature)
+			ok, err := VerifyDetached(dataPath, sigPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, ok)
+			}
+		})
+	}
+}
+
+func TestVerifyDetachedMissingFile(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	dataPath, sigPath := writeDetached(t, "data", Sign("data"))
+	if _, err := VerifyDetached(dataPath, sigPath+".missing"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error for the signature, got %v", err)
+	}
+	if _, err := VerifyDetached(dataPath+".missing", sigPath); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error for the data, got %v", err)
+	}
+}
+
+func TestVerifyDetachedTooLarge(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	SetMaxSignDataLength(4)
+	defer SetMaxSignDataLength(0)
+	dataPath, sigPath := writeDetached(t, "too large", Sign("too large"))
+	if _, err := VerifyDetached(dataPath, sigPath); !errors.Is(err, ErrSignDataTooLarge) {
+		t.Errorf("expected ErrSignDataTooLarge, got %v", err)
+	}
+}
+
+func TestSignDetached(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	if err := UseSHA512(); err != nil {
+		t.Fatal(err)
+	}
+	defer UseSHA256()
+	dataPath, sigPath := writeDetached(t, `{"name":"bundle"}`, "")
+	if err := SignDetached(dataPath, sigPath); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(sigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if len(lines) < 2 || len(lines[0]) != detachedSignatureWidth {
+		t.Errorf("expected the long signature to be wrapped, got %q", content)
+	}
+	if strings.Join(lines, "") != Sign(`{"name":"bundle"}`) {
+		t.Errorf("expected the wrapped signature to be the signature of the payload")
+	}
+	if ok, err := VerifyDetached(dataPath, sigPath); !ok || err != nil {
+		t.Errorf("expected the wrapped signature to verify, got %v, %v", ok, err)
+	}
+	crlf := strings.ReplaceAll(string(content), "\n", "\r\n")
+	if err := ioutil.WriteFile(sigPath, []byte(crlf), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyDetached(dataPath, sigPath); !ok || err != nil {
+		t.Errorf("expected CRLF line breaks to verify, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// MismatchReport explains why a signature doesn't verify without revealing the SK or the payload
+type MismatchReport struct {
+	// Encoding is the format expected by the configured codec
+	Encoding string
+	// Decoded is whether the received signature decoded, DecodeError tells why not
+	Decoded     bool
+	DecodeError string
+	// ExpectedLength and ReceivedLength are the lengths of the decoded digests
+	ExpectedLength int
+	ReceivedLength int
+	// FirstDifference is the index of the first byte differing between the decoded digests, -1 if none
+	FirstDifference int
+	// SigningStringHash is the hex sha256 of the signing string, to compare with the client one
+	SigningStringHash string
+	// KeyFingerprint identifies the SK the signature is expected from
+	KeyFingerprint string
+	Matched        bool
+	// Disabled is set while Disable is in force, nothing is compared
+	Disabled bool
+}
+
+// String formats the report for a log line
+func (report MismatchReport) String() string {
+	if report.Disabled {
+		return ErrCredentialsDisabled.Error()
+	}
+	if !report.Decoded {
+		return fmt.Sprintf("signature isn't %s: %s, signingStringHash: %s, key: %s",
+			report.Encoding, report.DecodeError, report.SigningStringHash, report.KeyFingerprint)
+	}
+	return fmt.Sprintf("matched: %v, expected length: %d, received length: %d, first difference: %d, signingStringHash: %s, key: %s",
+		report.Matched, report.ExpectedLength, report.ReceivedLength, report.FirstDifference, report.SigningStringHash, report.KeyFingerprint)
+}
+
+// DiagnoseMismatch compares a received signature with the one expected under the in-memory SK and reports
+// where they disagree: whether it decoded with the configured codec, the digest lengths, the first differing
+// byte and the hash of the signing string, which a client can compute to tell a payload difference from a
+// key difference. It's for the server side, after Auth failed.
+func DiagnoseMismatch(signData, receivedSign string) MismatchReport {
+	if credentialsDisabled.Load() {
+		return MismatchReport{FirstDifference: -1, Disabled: true}
+	}
+	secretKey, codec, _ := getSigningState()
+	signingString := sha256.Sum256([]byte(SigningString(signData)))
+	report := MismatchReport{
+		Encoding:          codecEncoding(codec),
+		FirstDifference:   -1,
+		SigningStringHash: hex.EncodeToString(signingString[:]),
+		KeyFingerprint:    KeyFingerprint(secretKey),
+	}
+	expected := digest(signData, secretKey)
+	report.ExpectedLength = len(expected)
+	received, err := codec.Decode(receivedSign)
+	if err != nil {
+		report.DecodeError = err.Error()
+		return report
+	}
+	report.Decoded = true
+	report.ReceivedLength = len(received)
+	for i := 0; i < len(expected) && i < len(received); i++ {
+		if expected[i] != received[i] {
+			report.FirstDifference = i
+			break
+		}
+	}
+	if report.FirstDifference < 0 && len(expected) != len(received) {
+		report.FirstDifference = min(len(expected), len(received))
+	}
+	report.Matched = report.FirstDifference < 0
+	return report
+}
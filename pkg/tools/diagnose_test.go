@@ -0,0 +1,67 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestDiagnoseMismatch(t *testing.T) {
+	setTestKeys(t, "ak", "secret-key")
+	report := DiagnoseMismatch("payload", Sign("payload"))
+	if !report.Matched || report.FirstDifference != -1 || report.ExpectedLength != sha256.Size {
+		t.Errorf("expected a matching report, got %+v", report)
+	}
+
+	corrupted := digest("payload", "secret-key")
+	corrupted[5] ^= 1
+	report = DiagnoseMismatch("payload", HexBase64Codec{}.Encode(corrupted))
+	if report.Matched || !report.Decoded || report.FirstDifference != 5 {
+		t.Errorf("expected the first difference at 5, got %+v", report)
+	}
+	if strings.Contains(report.String(), "secret-key") || strings.Contains(report.String(), "payload") {
+		t.Errorf("expected the report not to reveal the secret or the payload, got %s", report)
+	}
+}
+
+func TestDiagnoseMismatchDecodeFailure(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	report := DiagnoseMismatch("data", "not base64!")
+	if report.Decoded || report.DecodeError == "" || report.Encoding != EncodingHexBase64 {
+		t.Errorf("expected a decode failure, got %+v", report)
+	}
+	// a base64 signature sent to a server expecting hex+base64
+	report = DiagnoseMismatch("data", Base64Codec{}.Encode(digest("data", "sk")))
+	if report.Decoded {
+		t.Errorf("expected a signature in another format not to decode, got %+v", report)
+	}
+}
+
+func TestDiagnoseMismatchLength(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	truncated := digest("data", "sk")[:20]
+	report := DiagnoseMismatch("data", HexBase64Codec{}.Encode(truncated))
+	if report.Matched || report.ReceivedLength != 20 || report.ExpectedLength != sha256.Size || report.FirstDifference != 20 {
+		t.Errorf("expected a length mismatch, got %+v", report)
+	}
+	sha512Like := append(digest("data", "sk"), make([]byte, 32)...)
+	if report := DiagnoseMismatch("data", HexBase64Codec{}.Encode(sha512Like)); report.ReceivedLength != 64 || report.Matched {
+		t.Errorf("expected a longer digest to be reported, got %+v", report)
+	}
+}
@@ -0,0 +1,41 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DumpSafeConfig returns a readable snapshot of the application info and the AK to attach to support
+// tickets instead of the raw cert file, the SK is never included
+func DumpSafeConfig() (string, error) {
+	appInstance, appGroup, err := ReadAppInfoFromFile()
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	builder := strings.Builder{}
+	builder.WriteString("# chaos agent config, secrets are omitted\n")
+	fmt.Fprintf(&builder, "appFile=%s\n", GetAppFile())
+	fmt.Fprintf(&builder, "%s=%s\n", AppInstanceKeyName, appInstance)
+	fmt.Fprintf(&builder, "%s=%s\n", AppGroupKeyName, appGroup)
+	fmt.Fprintf(&builder, "certFile=%s\n", GetCertFile())
+	fmt.Fprintf(&builder, "%s=%s\n", AccessKeyName, GetAccessKey())
+	fmt.Fprintf(&builder, "%s=<omitted>\n", SecretKeyName)
+	return builder.String(), nil
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDumpSafeConfig(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	if err := CommitAll(Credentials{"the-access-key", "the-secret-key"}, AppInfo{"the-instance", "the-group"}); err != nil {
+		t.Fatal(err)
+	}
+	dump, err := DumpSafeConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"the-access-key", "the-instance", "the-group", "secrets are omitted"} {
+		if !strings.Contains(dump, expected) {
+			t.Errorf("expected dump to contain %s, got %s", expected, dump)
+		}
+	}
+	if strings.Contains(dump, "the-secret-key") {
+		t.Errorf("expected dump not to contain the SK, got %s", dump)
+	}
+}
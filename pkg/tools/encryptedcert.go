@@ -0,0 +1,187 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	encryptedCertMagic   = "CHEN"
+	encryptedCertVersion = 1
+)
+
+var (
+	ErrInvalidKEK           = errors.New("invalid key encryption key")
+	ErrInvalidEncryptedCert = errors.New("invalid encrypted cert file")
+)
+
+// RecordSecretKeyEncrypted records AK/SK to the cert file encrypted at rest with AES-256-GCM under kek,
+// a 32 bytes key encryption key: magic, version, nonce, then the sealed key=value lines with the header
+// as additional data. The plaintext is only held in memory.
+func RecordSecretKeyEncrypted(accessKey, secretKey string, kek []byte) error {
+	if accessKey == "" || secretKey == "" {
+		return errors.New("accessKey or secretKey is empty")
+	}
+	if err := checkSecretStrength(secretKey); err != nil {
+		return err
+	}
+	if skip, err := skipPersistence(); skip {
+		setCredentials(accessKey, secretKey)
+		return err
+	}
+	plaintext := encodeMap(map[string]string{
+		AccessKeyName: accessKey,
+		SecretKeyName: secretKey,
+	})
+	defer clear(plaintext)
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return err
+	}
+	content, err := encryptCert(plaintext, kek)
+	if err != nil {
+		return err
+	}
+	if err := replaceCertFile(certFile, content); err != nil {
+		return err
+	}
+	recordCertFileState(certFile)
+	return setCredentialsFrom(certFileSource(certFile, certFormatEncrypted), accessKey, secretKey)
+}
+
+// LoadSecretKeyEncrypted loads AK/SK from the cert file written by RecordSecretKeyEncrypted
+func LoadSecretKeyEncrypted(kek []byte) error {
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return err
+	}
+	plaintext, err := decryptCert(content, kek)
+	if err != nil {
+		return err
+	}
+	defer clear(plaintext)
+	data := make(map[string]string)
+	for _, line := range strings.Split(string(plaintext), "\n") {
+		if kv := strings.SplitN(line, Delimiter, 2); len(kv) == 2 {
+			data[kv[0]] = kv[1]
+		}
+	}
+	accessKey, secretKey := data[AccessKeyName], data[SecretKeyName]
+	if accessKey == "" || secretKey == "" {
+		return fmt.Errorf("%w: accessKey or secretKey is empty", ErrInvalidEncryptedCert)
+	}
+	if err := checkSecretStrength(secretKey); err != nil {
+		return err
+	}
+	recordCertFileState(certFile)
+	return setCredentialsFrom(certFileSource(certFile, certFormatEncrypted), accessKey, secretKey)
+}
+
+// RekeyCredentialFile re-encrypts the cert file written by RecordSecretKeyEncrypted from oldKEK to newKEK,
+// for KEK rotation. The content is decrypted in memory and the new file is staged in a temp file renamed
+// over the cert file, so the plaintext SK never reaches the disk and a failure leaves the old file intact.
+func RekeyCredentialFile(oldKEK, newKEK []byte) error {
+	if skip, err := skipPersistence(); skip {
+		return err
+	}
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return err
+	}
+	plaintext, err := decryptCert(content, oldKEK)
+	if err != nil {
+		return err
+	}
+	defer clear(plaintext)
+	content, err = encryptCert(plaintext, newKEK)
+	if err != nil {
+		return err
+	}
+	if err := replaceCertFile(certFile, content); err != nil {
+		return err
+	}
+	recordCertFileState(certFile)
+	return nil
+}
+
+// replaceCertFile writes content to a temp file renamed over the cert file
+func replaceCertFile(certFile string, content []byte) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return replaceFile(certFile, content, 0o600)
+}
+
+func encryptedCertHeader() []byte {
+	return append([]byte(encryptedCertMagic), encryptedCertVersion)
+}
+
+func newCertAEAD(kek []byte) (cipher.AEAD, error) {
+	if len(kek) != 32 {
+		return nil, fmt.Errorf("%w: %d bytes instead of 32", ErrInvalidKEK, len(kek))
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptCert(plaintext, kek []byte) ([]byte, error) {
+	aead, err := newCertAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	header := encryptedCertHeader()
+	nonce := make([]byte, aead.NonceSize())
+	if err := readRandom(nonce); err != nil {
+		return nil, err
+	}
+	content := append(header, nonce...)
+	return aead.Seal(content, nonce, plaintext, header), nil
+}
+
+func decryptCert(content, kek []byte) ([]byte, error) {
+	aead, err := newCertAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	header := encryptedCertHeader()
+	if len(content) < len(header)+aead.NonceSize()+aead.Overhead() || !bytes.Equal(content[:len(header)], header) {
+		return nil, ErrInvalidEncryptedCert
+	}
+	nonce := content[len(header) : len(header)+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, content[len(header)+aead.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: wrong key or tampered file", ErrInvalidEncryptedCert)
+	}
+	return plaintext, nil
+}
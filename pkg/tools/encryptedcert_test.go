@@ -0,0 +1,98 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRekeyCredentialFile(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	oldKEK, newKEK := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	if err := RecordSecretKeyEncrypted("ak", "plain-secret", oldKEK); err != nil {
+		t.Fatal(err)
+	}
+	if err := RekeyCredentialFile(oldKEK, newKEK); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(content, []byte("plain-secret")) {
+		t.Errorf("expected the SK not to be written in plaintext")
+	}
+	entries, _ := os.ReadDir(filepath.Dir(certFile))
+	for _, entry := range entries {
+		if data, _ := os.ReadFile(filepath.Join(filepath.Dir(certFile), entry.Name())); bytes.Contains(data, []byte("plain-secret")) {
+			t.Errorf("expected no file to hold the plaintext SK, found %s", entry.Name())
+		}
+	}
+
+	setTestKeys(t, "", "")
+	if err := LoadSecretKeyEncrypted(oldKEK); !errors.Is(err, ErrInvalidEncryptedCert) {
+		t.Errorf("expected the old KEK to be rejected, got %v", err)
+	}
+	if err := LoadSecretKeyEncrypted(newKEK); err != nil {
+		t.Fatal(err)
+	}
+	if GetAccessKey() != "ak" || GetSecureKey() != "plain-secret" {
+		t.Errorf("expected the keys to decrypt under the new KEK")
+	}
+}
+
+func TestRekeyCredentialFileKeepsFileOnFailure(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	kek := bytes.Repeat([]byte{1}, 32)
+	if err := RecordSecretKeyEncrypted("ak", "sk", kek); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(certFile)
+	if err := RekeyCredentialFile(bytes.Repeat([]byte{3}, 32), kek); !errors.Is(err, ErrInvalidEncryptedCert) {
+		t.Errorf("expected a wrong old KEK to be rejected, got %v", err)
+	}
+	if err := RekeyCredentialFile(kek, []byte("short")); !errors.Is(err, ErrInvalidKEK) {
+		t.Errorf("expected ErrInvalidKEK, got %v", err)
+	}
+	if after, _ := os.ReadFile(certFile); !bytes.Equal(before, after) {
+		t.Errorf("expected a failed rekey to leave the file intact")
+	}
+}
+
+func TestEncryptCertUsesRandReader(t *testing.T) {
+	SetRandReader(bytes.NewReader(bytes.Repeat([]byte{0xab}, 64)))
+	defer SetRandReader(nil)
+	kek := bytes.Repeat([]byte{1}, 32)
+	first, err := encryptCert([]byte("AK=ak\nSK=sk\n"), kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := encryptCert([]byte("AK=ak\nSK=sk\n"), kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Errorf("expected the nonce to come from the rand reader")
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// AccessKeyEnv and SecretKeyEnv hold the credentials injected by the environment instead of the cert file
+const (
+	AccessKeyEnv = "CHAOS_ACCESS_KEY"
+	SecretKeyEnv = "CHAOS_SECRET_KEY"
+)
+
+// LoadSecretKeyFromEnv loads the in-memory keys from CHAOS_ACCESS_KEY and CHAOS_SECRET_KEY
+func LoadSecretKeyFromEnv() error {
+	accessKey, secretKey := os.Getenv(AccessKeyEnv), os.Getenv(SecretKeyEnv)
+	if accessKey == "" || secretKey == "" {
+		return fmt.Errorf("%s or %s is empty", AccessKeyEnv, SecretKeyEnv)
+	}
+	defaultManager.forgetCertFile()
+	return setCredentialsFrom(credentialSource{kind: sourceEnv, reload: LoadSecretKeyFromEnv}, accessKey, secretKey)
+}
+
+// DeriveEnvReference returns the environment variable to inject the loaded SK with, for moving off the
+// cert file. The value is the secret itself, the caller must only print it to its destination.
+func DeriveEnvReference() (varName, value string, err error) {
+	secretKey := GetSecureKey()
+	if secretKey == "" {
+		return "", "", errors.New("secretKey is empty")
+	}
+	return SecretKeyEnv, secretKey, nil
+}
+
+// WriteEnvReference writes a systemd drop-in injecting the loaded AK and SK into the environment, read
+// back by LoadSecretKeyFromEnv. If removeFile is set, the cert file is then removed by Logout. The secret
+// is only written to w, never logged.
+func WriteEnvReference(w io.Writer, removeFile bool) error {
+	varName, value, err := DeriveEnvReference()
+	if err != nil {
+		return err
+	}
+	accessKey := GetAccessKey()
+	if accessKey == "" {
+		return errors.New("accessKey is empty")
+	}
+	_, err = fmt.Fprintf(w, "[Service]\nEnvironment=%s\nEnvironment=%s\n",
+		strconv.Quote(AccessKeyEnv+"="+accessKey), strconv.Quote(varName+"="+value))
+	if err != nil || !removeFile {
+		return err
+	}
+	return Logout()
+}
+
+// Logout removes the cert file and forgets the in-memory keys
+func Logout() error {
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return err
+	}
+	skip, skipErr := skipPersistence()
+	if !skip {
+		mutex.Lock()
+		err = os.Remove(certFile)
+		mutex.Unlock()
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	defaultManager.forgetCertFile()
+	setCredentials("", "")
+	return skipErr
+}
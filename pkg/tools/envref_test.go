@@ -0,0 +1,71 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWriteEnvReference(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	logs := captureLog(t)
+	if err := RecordSecretKeyToFile("ak", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	varName, value, err := DeriveEnvReference()
+	if err != nil || varName != SecretKeyEnv || value != "secret" {
+		t.Errorf("unexpected reference %s=%s, %v", varName, value, err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteEnvReference(buf, false); err != nil {
+		t.Fatal(err)
+	}
+	expected := "[Service]\nEnvironment=\"CHAOS_ACCESS_KEY=ak\"\nEnvironment=\"CHAOS_SECRET_KEY=secret\"\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+	if _, err := os.Stat(certFile); err != nil {
+		t.Errorf("expected the cert file to be kept, got %v", err)
+	}
+
+	if err := WriteEnvReference(&bytes.Buffer{}, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(certFile); !os.IsNotExist(err) {
+		t.Errorf("expected the cert file to be removed, got %v", err)
+	}
+	if GetSecureKey() != "" {
+		t.Errorf("expected the in-memory keys to be forgotten")
+	}
+	if strings.Contains(logs.String(), "secret") {
+		t.Errorf("expected the secret not to be logged, got %q", logs.String())
+	}
+
+	t.Setenv(AccessKeyEnv, "ak")
+	t.Setenv(SecretKeyEnv, "secret")
+	if err := LoadSecretKeyFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if GetAccessKey() != "ak" || GetSecureKey() != "secret" {
+		t.Errorf("expected the keys to be loaded from the environment")
+	}
+}
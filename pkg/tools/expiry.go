@@ -0,0 +1,125 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ExpiryKeyName is the key of the credential expiry in the cert file, the value is in RFC 3339
+const ExpiryKeyName = "expiry"
+
+func parseExpiry(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (m *CredentialManager) setExpiry(expiry time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.expiry = expiry
+}
+
+// Expiry returns the expiry of the credentials, zero if they don't expire
+func (m *CredentialManager) Expiry() time.Time {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.expiry
+}
+
+// CredentialExpiry returns the expiry of the in-memory credentials, zero if they don't expire.
+// It's loaded from the cert file with the keys and reset when the keys change.
+func CredentialExpiry() time.Time {
+	return defaultManager.Expiry()
+}
+
+// RecordCredentialExpiry records the expiry of the in-memory credentials into the cert file next to them,
+// ErrNotTextCertFile is returned unless they were loaded from the cert file in the text format
+func RecordCredentialExpiry(expiry time.Time) error {
+	accessKey, secretKey := GetAccessKey(), GetSecureKey()
+	if accessKey == "" || secretKey == "" {
+		return errors.New("accessKey or secretKey is empty")
+	}
+	if skip, err := skipPersistence(); skip {
+		defaultManager.setExpiry(expiry)
+		return err
+	}
+	keys := map[string]string{
+		AccessKeyName: accessKey,
+		SecretKeyName: secretKey,
+	}
+	if !expiry.IsZero() {
+		keys[ExpiryKeyName] = expiry.UTC().Format(time.RFC3339)
+	}
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return err
+	}
+	if err := checkTextCertFile(certFile); err != nil {
+		return err
+	}
+	if err := writeCredentialFile(withKeyPolicy(keys), certFile); err != nil {
+		return err
+	}
+	recordCertFileState(certFile)
+	defaultManager.setExpiry(expiry)
+	return nil
+}
+
+// CredentialsExpiringWithin returns whether the in-memory credentials expire within d, credentials
+// without expiry never do
+func CredentialsExpiringWithin(d time.Duration) bool {
+	expiry := CredentialExpiry()
+	return !expiry.IsZero() && timeNow().Add(d).After(expiry)
+}
+
+// WatchCredentialExpiry checks every interval whether the credentials expire within the warning
+// duration, and then logs a warning and calls callback with the expiry, so that the agent can re-enroll
+// in time. It stops when ctx is done. A non-positive interval is logged and ignored.
+func WatchCredentialExpiry(ctx context.Context, interval, warning time.Duration, callback func(expiry time.Time)) {
+	if interval <= 0 {
+		log.Warnf("expiry watch interval must be positive, got %s, the credential expiry won't be watched", interval)
+		return
+	}
+	ctx, done := startBackground(ctx)
+	go func() {
+		defer done()
+		defer PanicPrintStack()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if CredentialsExpiringWithin(warning) {
+				expiry := CredentialExpiry()
+				log.WithField("expiry", expiry).Warningf("credentials of %s expire soon", GetAccessKey())
+				if callback != nil {
+					callback(expiry)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
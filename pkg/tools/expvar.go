@@ -0,0 +1,64 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+)
+
+// ExpvarName is the key of the auth counters in the expvar map
+const ExpvarName = "chaos_agent_auth"
+
+// counters of the auth activity, always maintained and published on demand by PublishExpvar
+type counters struct {
+	signs       atomic.Int64
+	authSuccess atomic.Int64
+	authFailure atomic.Int64
+	fileWrites  atomic.Int64
+	publishOnce sync.Once
+}
+
+var authCounters = &counters{}
+
+func (c *counters) countAuth(ok bool) {
+	if ok {
+		c.authSuccess.Add(1)
+	} else {
+		c.authFailure.Add(1)
+	}
+}
+
+func (c *counters) snapshot() map[string]int64 {
+	return map[string]int64{
+		"signs":       c.signs.Load(),
+		"authSuccess": c.authSuccess.Load(),
+		"authFailure": c.authFailure.Load(),
+		"fileWrites":  c.fileWrites.Load(),
+	}
+}
+
+// PublishExpvar publishes the sign, auth and file write counters under ExpvarName, so that they're
+// served by /debug/vars. It's opt-in to keep the global expvar map clean, calling it again is a no-op.
+func PublishExpvar() {
+	authCounters.publishOnce.Do(func() {
+		expvar.Publish(ExpvarName, expvar.Func(func() interface{} {
+			return authCounters.snapshot()
+		}))
+	})
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+)
+
+func readExpvar(t *testing.T) map[string]int64 {
+	t.Helper()
+	v := expvar.Get(ExpvarName)
+	if v == nil {
+		t.Fatalf("expected %s to be published", ExpvarName)
+	}
+	values := make(map[string]int64)
+	if err := json.Unmarshal([]byte(v.String()), &values); err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func TestPublishExpvar(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	captureLog(t)
+	PublishExpvar()
+	PublishExpvar()
+	before := readExpvar(t)
+
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	sign := Sign("data")
+	Auth(sign, "data")
+	Auth(sign, "data")
+	Auth("bad", "data")
+
+	after := readExpvar(t)
+	expected := map[string]int64{"signs": 1, "authSuccess": 2, "authFailure": 1, "fileWrites": 1}
+	for key, delta := range expected {
+		if after[key]-before[key] != delta {
+			t.Errorf("expected %s to increase by %d, got %d", key, delta, after[key]-before[key])
+		}
+	}
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrFIFOTimeout = errors.New("credential FIFO timeout")
+
+// LoadSecretKeyFromReader loads the in-memory keys from AK=... and SK=... lines read until EOF,
+// nothing is persisted
+func LoadSecretKeyFromReader(r io.Reader) error {
+	data := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), MaxLineLength)
+	for scanner.Scan() {
+		kv := strings.SplitN(strings.TrimSpace(scanner.Text()), Delimiter, 2)
+		if len(kv) == 2 {
+			data[kv[0]] = kv[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	accessKey, secretKey := data[AccessKeyName], data[SecretKeyName]
+	if accessKey == "" || secretKey == "" {
+		return errors.New("accessKey or secretKey is empty")
+	}
+	if err := checkSecretStrength(secretKey); err != nil {
+		return err
+	}
+	defaultManager.forgetCertFile()
+	return setCredentialsFrom(credentialSource{kind: sourceReader}, accessKey, secretKey)
+}
+
+// LoadSecretKeyFromFIFO loads the in-memory keys written once to a named pipe by a secret injector,
+// keeping them off persistent storage. Opening blocks until the writer opens the pipe and reading
+// lasts until it closes it, both within timeout, so that a never written FIFO doesn't hang the agent.
+func LoadSecretKeyFromFIFO(filePath string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	type openResult struct {
+		file *os.File
+		err  error
+	}
+	opened := make(chan openResult, 1)
+	go func() {
+		defer PanicPrintStack()
+		file, err := os.Open(filePath)
+		opened <- openResult{file, err}
+	}()
+	var file *os.File
+	select {
+	case result := <-opened:
+		if result.err != nil {
+			return result.err
+		}
+		file = result.file
+	case <-time.After(timeout):
+		// open the write end without blocking so that the pending open returns
+		if writer, err := os.OpenFile(filePath, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+			writer.Close()
+		}
+		go func() {
+			if result := <-opened; result.file != nil {
+				result.file.Close()
+			}
+		}()
+		return fmt.Errorf("%w: no writer opened %s within %v", ErrFIFOTimeout, filePath, timeout)
+	}
+	defer file.Close()
+	// a FIFO is pollable, so the read is bounded too
+	if err := file.SetReadDeadline(deadline); err != nil {
+		return err
+	}
+	err := LoadSecretKeyFromReader(file)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("%w: the writer of %s didn't close it within %v", ErrFIFOTimeout, filePath, timeout)
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+//go:build !windows
+
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLoadSecretKeyFromReaderPipe(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	go func() {
+		defer writer.Close()
+		io.WriteString(writer, "AK=ak\n")
+		time.Sleep(10 * time.Millisecond)
+		io.WriteString(writer, "SK=sk\n")
+	}()
+	if err := LoadSecretKeyFromReader(reader); err != nil {
+		t.Fatal(err)
+	}
+	if GetAccessKey() != "ak" || GetSecureKey() != "sk" {
+		t.Errorf("expected the keys to be read until EOF")
+	}
+	if _, err := os.Stat(certFile); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be persisted, got %v", err)
+	}
+}
+
+func makeTestFIFO(t *testing.T) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), "credentials")
+	if err := syscall.Mkfifo(filePath, 0o600); err != nil {
+		t.Skipf("mkfifo unsupported: %v", err)
+	}
+	return filePath
+}
+
+func TestLoadSecretKeyFromFIFO(t *testing.T) {
+	setTestKeys(t, "", "")
+	filePath := makeTestFIFO(t)
+	go func() {
+		writer, err := os.OpenFile(filePath, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		defer writer.Close()
+		io.WriteString(writer, "AK=ak\nSK=sk\n")
+	}()
+	if err := LoadSecretKeyFromFIFO(filePath, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if GetSecureKey() != "sk" {
+		t.Errorf("expected the keys to be loaded from the FIFO")
+	}
+}
+
+func TestLoadSecretKeyFromFIFOTimeout(t *testing.T) {
+	setTestKeys(t, "", "")
+	filePath := makeTestFIFO(t)
+	if err := LoadSecretKeyFromFIFO(filePath, 20*time.Millisecond); !errors.Is(err, ErrFIFOTimeout) {
+		t.Errorf("expected ErrFIFOTimeout without writer, got %v", err)
+	}
+
+	go func() {
+		writer, err := os.OpenFile(filePath, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		io.WriteString(writer, "AK=ak\n")
+		time.Sleep(200 * time.Millisecond)
+		writer.Close()
+	}()
+	if err := LoadSecretKeyFromFIFO(filePath, 50*time.Millisecond); !errors.Is(err, ErrFIFOTimeout) {
+		t.Errorf("expected ErrFIFOTimeout for a writer not closing, got %v", err)
+	}
+}
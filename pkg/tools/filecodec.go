@@ -0,0 +1,105 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"sigs.k8s.io/yaml"
+)
+
+// FileCodec encodes the maps of the cert file and the app file
+type FileCodec interface {
+	Marshal(data map[string]string) ([]byte, error)
+	Unmarshal(content []byte) (map[string]string, error)
+}
+
+// KeyValueCodec is the default format: key=value lines sorted by key, the checksum being the trailing line
+type KeyValueCodec struct{}
+
+func (KeyValueCodec) Marshal(data map[string]string) ([]byte, error) {
+	lines := make(map[string]string, len(data))
+	for key, value := range data {
+		if key != ChecksumKeyName {
+			lines[key] = value
+		}
+	}
+	content := encodeMap(lines)
+	if checksum, ok := data[ChecksumKeyName]; ok {
+		content = append(content, ChecksumKeyName+Delimiter+checksum+"\n"...)
+	}
+	return content, nil
+}
+
+// Unmarshal parses the key=value lines, malformed lines are skipped
+func (KeyValueCodec) Unmarshal(content []byte) (map[string]string, error) {
+	data := make(map[string]string)
+	for _, line := range strings.Split(string(content), "\n") {
+		parseKeyValueLine(data, line)
+	}
+	return data, nil
+}
+
+func parseKeyValueLine(data map[string]string, line string) {
+	kv := strings.SplitN(strings.TrimSpace(line), Delimiter, 2)
+	if len(kv) == 2 {
+		data[kv[0]] = kv[1]
+	}
+}
+
+// YAMLCodec encodes the files as a YAML mapping of strings, for configuration tooling standardized on YAML
+type YAMLCodec struct{}
+
+func (YAMLCodec) Marshal(data map[string]string) ([]byte, error) {
+	return yaml.Marshal(data)
+}
+
+func (YAMLCodec) Unmarshal(content []byte) (map[string]string, error) {
+	data := make(map[string]string)
+	if err := yaml.Unmarshal(content, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// fileCodec holds the FileCodec of the files, nil for KeyValueCodec. It's atomic rather than guarded by the
+// mutex because the files are read with the mutex held.
+var fileCodec atomic.Pointer[FileCodec]
+
+// SetFileCodec sets the codec used to read and write the cert file and the app file, nil restores the
+// default KeyValueCodec. The existing files aren't converted, they must be rewritten.
+func SetFileCodec(codec FileCodec) {
+	if codec == nil {
+		fileCodec.Store(nil)
+		return
+	}
+	fileCodec.Store(&codec)
+}
+
+func getFileCodec() FileCodec {
+	if codec := fileCodec.Load(); codec != nil {
+		return *codec
+	}
+	return KeyValueCodec{}
+}
+
+// lineCodec returns whether the files are in the key=value lines of KeyValueCodec, which are streamed
+func lineCodec() bool {
+	_, ok := getFileCodec().(KeyValueCodec)
+	return ok
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func setTestFileCodec(t *testing.T, codec FileCodec) {
+	t.Helper()
+	SetFileCodec(codec)
+	t.Cleanup(func() { SetFileCodec(nil) })
+}
+
+func TestYAMLCodecRoundTrip(t *testing.T) {
+	data := map[string]string{
+		AccessKeyName:      "ak",
+		SecretKeyName:      "s#k: \"quoted\"",
+		AppGroupKeyName:    "123",
+		AppInstanceKeyName: "",
+	}
+	content, err := YAMLCodec{}.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := YAMLCodec{}.Unmarshal(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, data) {
+		t.Errorf("expected %v to round-trip, got %v from %q", data, decoded, content)
+	}
+
+	decoded, err = YAMLCodec{}.Unmarshal([]byte("# credentials\nAK: ak\nSK: 'sk'\n"))
+	if err != nil || decoded[AccessKeyName] != "ak" || decoded[SecretKeyName] != "sk" {
+		t.Errorf("expected hand-written YAML to parse, got %v, %v", decoded, err)
+	}
+}
+
+func TestYAMLCodecFiles(t *testing.T) {
+	setTestKeys(t, "", "")
+	appFile, certFile := setTestFiles(t)
+	setTestFileCodec(t, YAMLCodec{})
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RecordApplicationToFile("instance", "group", true); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := (YAMLCodec{}).Unmarshal(content); err != nil || data[SecretKeyName] != "sk" {
+		t.Errorf("expected the cert file in YAML, got %q, %v", content, err)
+	}
+
+	setTestKeys(t, "", "")
+	if err := LoadSecretKeyFromFile(); err != nil || GetAccessKey() != "ak" {
+		t.Errorf("expected the YAML cert file to load, got %v", err)
+	}
+	if instance, group, err := ReadAppInfoFromFile(); err != nil || instance != "instance" || group != "group" {
+		t.Errorf("expected the YAML app file to load with its checksum, got %s, %s, %v", instance, group, err)
+	}
+	if keys, err := ListKeys(appFile); err != nil || !reflect.DeepEqual(keys, []string{AppGroupKeyName, AppInstanceKeyName, ChecksumKeyName}) {
+		t.Errorf("unexpected keys %v, %v", keys, err)
+	}
+}
+
+func TestKeyValueCodecRoundTrip(t *testing.T) {
+	data := map[string]string{"b": "2", "a": "1", ChecksumKeyName: "sum"}
+	content, err := KeyValueCodec{}.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "a=1\nb=2\nchecksum=sum\n" {
+		t.Errorf("expected sorted lines with the trailing checksum, got %q", content)
+	}
+	if decoded, _ := (KeyValueCodec{}).Unmarshal(content); !reflect.DeepEqual(decoded, data) {
+		t.Errorf("expected %v to round-trip, got %v", data, decoded)
+	}
+}
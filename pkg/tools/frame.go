@@ -0,0 +1,68 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+// The scheme tags of SignFrame and SignAggregate, see partsScheme
+const (
+	frameScheme     = "frame"
+	aggregateScheme = "aggregate"
+)
+
+// frameSigningData prefixes the payload with the length-prefixed connection id
+func frameSigningData(connID string, payload []byte) string {
+	return partsSigningString([]string{connID}) + string(payload)
+}
+
+// VerifyAggregate verifies the signature of a batch of frames produced by SignAggregate
+func VerifyAggregate(frames [][]byte, sign string) bool {
+	return Auth(sign, aggregateSigningData(frames))
+}
+
+func aggregateSigningData(frames [][]byte) string {
+	parts := make([]string, len(frames))
+	for i, frame := range frames {
+		parts[i] = string(frame)
+	}
+	return schemeSigningString(aggregateScheme, parts)
+}
+
+// FrameVerifier verifies the frames signed by SignFrame with the in-memory keys, the counter must
+// increase per connection. It tracks at most capacity connections like SequenceVerifier.
+type FrameVerifier struct {
+	sequences *SequenceVerifier
+}
+
+// NewFrameVerifier returns a verifier tracking the counters of at most capacity connections
+func NewFrameVerifier(capacity int) (*FrameVerifier, error) {
+	sequences, err := NewSequenceVerifier(capacity, nil)
+	if err != nil {
+		return nil, err
+	}
+	sequences.scheme = frameScheme
+	return &FrameVerifier{sequences: sequences}, nil
+}
+
+// VerifyFrame checks the signature of a frame of connID, then that its counter is greater than the last
+// accepted one of the connection. It returns ErrSignMismatch or ErrSequenceNotIncreasing.
+func (verifier *FrameVerifier) VerifyFrame(connID string, counter uint64, payload []byte, sign string) error {
+	return verifier.sequences.Verify(connID, sign, frameSigningData(connID, payload), counter)
+}
+
+// Close forgets the counter of a closed connection
+func (verifier *FrameVerifier) Close(connID string) {
+	verifier.sequences.forget(connID)
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifyFrame(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	captureLog(t)
+	verifier, err := NewFrameVerifier(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte("heartbeat")
+
+	for counter := uint64(1); counter <= 3; counter++ {
+		if err := verifier.VerifyFrame("conn1", counter, payload, SignFrame("conn1", counter, payload)); err != nil {
+			t.Errorf("expected frame %d to verify, got %v", counter, err)
+		}
+	}
+	if err := verifier.VerifyFrame("conn1", 2, payload, SignFrame("conn1", 2, payload)); !errors.Is(err, ErrSequenceNotIncreasing) {
+		t.Errorf("expected a replayed frame to be rejected, got %v", err)
+	}
+	if err := verifier.VerifyFrame("conn2", 4, payload, SignFrame("conn1", 4, payload)); !errors.Is(err, ErrSignMismatch) {
+		t.Errorf("expected a frame of another connection to be rejected, got %v", err)
+	}
+	if err := verifier.VerifyFrame("conn2", 1, payload, SignFrame("conn2", 1, payload)); err != nil {
+		t.Errorf("expected the counter to be tracked per connection, got %v", err)
+	}
+	if err := verifier.VerifyFrame("conn1", 4, []byte("tampered"), SignFrame("conn1", 4, payload)); !errors.Is(err, ErrSignMismatch) {
+		t.Errorf("expected a tampered payload to be rejected, got %v", err)
+	}
+
+	verifier.Close("conn1")
+	if err := verifier.VerifyFrame("conn1", 1, payload, SignFrame("conn1", 1, payload)); err != nil {
+		t.Errorf("expected a closed connection to start over, got %v", err)
+	}
+}
+
+func TestSignAggregate(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	frames := [][]byte{[]byte("first"), []byte("second"), []byte("third")}
+	sign := SignAggregate(frames)
+	if !VerifyAggregate(frames, sign) {
+		t.Fatal("expected the batch to verify")
+	}
+	for name, altered := range map[string][][]byte{
+		"reordered": {[]byte("second"), []byte("first"), []byte("third")},
+		"boundary":  {[]byte("firsts"), []byte("econd"), []byte("third")},
+		"merged":    {[]byte("firstsecond"), []byte("third")},
+		"dropped":   {[]byte("first"), []byte("second")},
+		"empty":     {[]byte("first"), []byte("second"), []byte("third"), {}},
+	} {
+		if VerifyAggregate(altered, sign) {
+			t.Errorf("expected the %s batch to be rejected", name)
+		}
+	}
+}
+
+func TestFrameSchemesTagged(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	captureLog(t)
+	if AuthParts(SignAggregate([][]byte{[]byte("a"), []byte("bc")}), "a", "bc") {
+		t.Errorf("expected a SignAggregate signature not to verify as SignParts")
+	}
+	verifier, err := NewSequenceVerifier(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.Verify("conn", SignFrame("conn", 1, []byte("data")), frameSigningData("conn", []byte("data")), 1); !errors.Is(err, ErrSignMismatch) {
+		t.Errorf("expected a SignFrame signature not to verify as SignSeq, got %v", err)
+	}
+}
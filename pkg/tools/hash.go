@@ -0,0 +1,87 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto"
+	"crypto/sha256"
+	// registers SHA-512 for UseSHA512
+	_ "crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"sync/atomic"
+)
+
+// hashSpec is the hash of the digest signed by Sign
+type hashSpec struct {
+	name    string
+	newHash func() hash.Hash
+	size    int
+}
+
+var (
+	sha256Spec = &hashSpec{name: "SHA-256", newHash: sha256.New, size: sha256.Size}
+
+	// signHash holds the *hashSpec in use, SHA-256 unless configured
+	signHash atomic.Value
+
+	ErrHashUnavailable = errors.New("hash unavailable")
+)
+
+func init() {
+	signHash.Store(sha256Spec)
+}
+
+func getHashSpec() *hashSpec {
+	return signHash.Load().(*hashSpec)
+}
+
+// SetHashFunc replaces the hash of Sign and Auth, both sides must use the same. The hash is constructed
+// once to fail here rather than at the first signature, e.g. when a FIPS-restricted build lacks it.
+func SetHashFunc(name string, newHash func() hash.Hash) error {
+	if newHash == nil {
+		return fmt.Errorf("%w: %s has no constructor", ErrHashUnavailable, name)
+	}
+	h := newHash()
+	if h == nil || h.Size() <= 0 {
+		return fmt.Errorf("%w: %s constructed no usable hash", ErrHashUnavailable, name)
+	}
+	signHash.Store(&hashSpec{name: name, newHash: newHash, size: h.Size()})
+	authVerifyCache.purge()
+	return nil
+}
+
+// SetHash is SetHashFunc for a hash of the crypto package, it must be linked into the binary
+func SetHash(h crypto.Hash) error {
+	if !h.Available() {
+		return fmt.Errorf("%w: %v isn't linked into the binary", ErrHashUnavailable, h)
+	}
+	return SetHashFunc(h.String(), h.New)
+}
+
+// UseSHA512 signs with SHA-512
+func UseSHA512() error {
+	return SetHash(crypto.SHA512)
+}
+
+// UseSHA256 restores the default SHA-256
+func UseSHA256() error {
+	signHash.Store(sha256Spec)
+	authVerifyCache.purge()
+	return nil
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto"
+	"crypto/sha512"
+	"errors"
+	"hash"
+	"testing"
+)
+
+func TestSetHashFuncUnavailable(t *testing.T) {
+	defer UseSHA256()
+	if err := SetHashFunc("nil", nil); !errors.Is(err, ErrHashUnavailable) {
+		t.Errorf("expected ErrHashUnavailable for a nil constructor, got %v", err)
+	}
+	if err := SetHashFunc("broken", func() hash.Hash { return nil }); !errors.Is(err, ErrHashUnavailable) {
+		t.Errorf("expected ErrHashUnavailable for a nil hash, got %v", err)
+	}
+	// not linked into the test binary
+	if err := SetHash(crypto.BLAKE2b_256); !errors.Is(err, ErrHashUnavailable) {
+		t.Errorf("expected ErrHashUnavailable for an unlinked hash, got %v", err)
+	}
+	if getHashSpec() != sha256Spec {
+		t.Errorf("expected a failed configuration to keep SHA-256")
+	}
+}
+
+func TestUseSHA512(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	captureLog(t)
+	sha256Sign := Sign("data")
+	if err := UseSHA512(); err != nil {
+		t.Fatal(err)
+	}
+	defer UseSHA256()
+
+	sign := Sign("data")
+	if len(sign) != SignatureLength() || SignatureLength() != len(HexBase64Codec{}.Encode(make([]byte, sha512.Size))) {
+		t.Errorf("expected SHA-512 sized signatures, got %d", len(sign))
+	}
+	if !Auth(sign, "data") || Auth(sha256Sign, "data") {
+		t.Errorf("expected only SHA-512 signatures to verify")
+	}
+	if AlgorithmDescriptor().Hash != "SHA-512" {
+		t.Errorf("expected the descriptor to report SHA-512, got %s", AlgorithmDescriptor().Hash)
+	}
+}
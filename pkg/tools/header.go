@@ -0,0 +1,131 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	headerAccessKeyName = "ak"
+	headerKeyIDName     = "kid"
+	headerSignName      = "sign"
+	headerSeparator     = ","
+)
+
+// DefaultHeaderLimit is the header budget of HeaderBudget, the smallest default of common proxies
+const DefaultHeaderLimit = 8 * 1024
+
+var (
+	ErrInvalidAuthHeader = errors.New("invalid auth header")
+	ErrKeyOwnerMismatch  = errors.New("key doesn't belong to the ak")
+
+	headerLimit atomic.Int64
+)
+
+func init() {
+	headerLimit.Store(DefaultHeaderLimit)
+}
+
+// AuthHeader is the content of the header built by BuildAuthHeader. KeyID optionally identifies the SK
+// on the server separately from the AK, like the kid of JWS.
+type AuthHeader struct {
+	AccessKey string
+	KeyID     string
+	Signature string
+}
+
+// String formats the header as ak=...,kid=...,sign=..., the kid is omitted if empty
+func (header AuthHeader) String() string {
+	fields := []string{headerAccessKeyName + Delimiter + header.AccessKey}
+	if header.KeyID != "" {
+		fields = append(fields, headerKeyIDName+Delimiter+header.KeyID)
+	}
+	fields = append(fields, headerSignName+Delimiter+header.Signature)
+	return strings.Join(fields, headerSeparator)
+}
+
+// SetHeaderLimit sets the header budget of HeaderBudget in bytes, e.g. the limit of the proxies in front of the server
+func SetHeaderLimit(bytes int) {
+	headerLimit.Store(int64(bytes))
+}
+
+// HeaderBudget returns the size of the headers carrying signData and its BuildAuthHeader value without kid,
+// and whether it fits the header limit, so that a caller can fail fast with a clear message on an oversized
+// signData, e.g. a long app instance name, instead of an opaque 431 from a proxy. Nothing is signed.
+func HeaderBudget(signData string) (ok bool, size int) {
+	header := AuthHeader{AccessKey: GetAccessKey(), Signature: strings.Repeat("=", SignatureLength())}
+	size = len(header.String()) + len(signData)
+	return int64(size) <= headerLimit.Load(), size
+}
+
+// ParseAuthHeader parses a header built by BuildAuthHeader
+func ParseAuthHeader(value string) (AuthHeader, error) {
+	var header AuthHeader
+	for _, field := range strings.Split(value, headerSeparator) {
+		kv := strings.SplitN(strings.TrimSpace(field), Delimiter, 2)
+		if len(kv) != 2 {
+			return AuthHeader{}, fmt.Errorf("%w: field %q isn't key=value", ErrInvalidAuthHeader, field)
+		}
+		switch kv[0] {
+		case headerAccessKeyName:
+			header.AccessKey = kv[1]
+		case headerKeyIDName:
+			header.KeyID = kv[1]
+		case headerSignName:
+			header.Signature = kv[1]
+		}
+	}
+	if header.AccessKey == "" || header.Signature == "" {
+		return AuthHeader{}, fmt.Errorf("%w: ak or sign is missing", ErrInvalidAuthHeader)
+	}
+	return header, nil
+}
+
+// VerifyAuthHeader verifies a header built by BuildAuthHeader like VerifyFor. The SK is looked up by the
+// kid of the header if present, otherwise by the AK, and lookup returns the AK owning it too. The ak of
+// the header isn't authenticated by the signature, so the header is rejected with ErrKeyOwnerMismatch
+// unless it's the owner, which is the AK checked against SetAKAllowlist.
+func VerifyAuthHeader(value, signData string, lookup func(id string) (ak, sk string, err error)) (bool, error) {
+	if err := checkCredentialsEnabled(); err != nil {
+		return false, err
+	}
+	header, err := ParseAuthHeader(value)
+	if err != nil {
+		return false, err
+	}
+	id := header.AccessKey
+	if header.KeyID != "" {
+		id = header.KeyID
+	}
+	owner, sk, err := lookup(id)
+	if err != nil {
+		return false, err
+	}
+	if owner != header.AccessKey {
+		return false, fmt.Errorf("%w: %s claimed by %s", ErrKeyOwnerMismatch, id, header.AccessKey)
+	}
+	if err := checkAKAllowed(owner); err != nil {
+		return false, err
+	}
+	return verifyFor(id, header.Signature, signData, func(string) (string, error) {
+		return sk, nil
+	})
+}
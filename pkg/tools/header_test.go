@@ -0,0 +1,110 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestAuthHeaderRoundTrip(t *testing.T) {
+	setTestKeys(t, "agent1", "sk1")
+	value, err := BuildAuthHeader("data", "key-2024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := ParseAuthHeader(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := AuthHeader{AccessKey: "agent1", KeyID: "key-2024", Signature: Sign("data")}
+	if header != expected {
+		t.Errorf("expected %+v, got %+v", expected, header)
+	}
+
+	value, err = BuildAuthHeader("data", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header, err := ParseAuthHeader(value); err != nil || header.KeyID != "" {
+		t.Errorf("expected no kid, got %+v, %v", header, err)
+	}
+}
+
+func TestVerifyAuthHeaderByKeyID(t *testing.T) {
+	setTestKeys(t, "agent1", "sk1")
+	captureLog(t)
+	lookup := lookupTestOwners(map[string]Credentials{
+		"key-2024": {AccessKey: "agent1", SecretKey: "sk1"},
+		"agent1":   {AccessKey: "agent1", SecretKey: "other"},
+	})
+
+	value, err := BuildAuthHeader("data", "key-2024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyAuthHeader(value, "data", lookup); err != nil || !ok {
+		t.Errorf("expected the SK to be looked up by kid, got %v, %v", ok, err)
+	}
+
+	value, err = BuildAuthHeader("data", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyAuthHeader(value, "data", lookup); err != nil || ok {
+		t.Errorf("expected the SK to be looked up by ak, got %v, %v", ok, err)
+	}
+
+	spoofed := AuthHeader{AccessKey: "agent2", KeyID: "key-2024", Signature: Sign("data")}.String()
+	if ok, err := VerifyAuthHeader(spoofed, "data", lookup); ok || !errors.Is(err, ErrKeyOwnerMismatch) {
+		t.Errorf("expected a kid presented by another AK to be rejected, got %v, %v", ok, err)
+	}
+}
+
+func TestParseAuthHeaderInvalid(t *testing.T) {
+	for _, value := range []string{"", "ak=agent1", "sign=abc", "ak=agent1,garbage,sign=abc"} {
+		if _, err := ParseAuthHeader(value); !errors.Is(err, ErrInvalidAuthHeader) {
+			t.Errorf("expected ErrInvalidAuthHeader for %q, got %v", value, err)
+		}
+	}
+	setTestKeys(t, "agent1", "sk1")
+	if _, err := BuildAuthHeader("data", "a,b"); !errors.Is(err, ErrInvalidAuthHeader) {
+		t.Errorf("expected ErrInvalidAuthHeader for a kid with a separator, got %v", err)
+	}
+}
+
+func TestHeaderBudget(t *testing.T) {
+	setTestKeys(t, "agent1", "sk1")
+	SetHeaderLimit(256)
+	defer SetHeaderLimit(DefaultHeaderLimit)
+	value, err := BuildAuthHeader("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fitting := strings.Repeat("x", 256-len(value))
+	if ok, size := HeaderBudget(fitting); !ok || size != 256 {
+		t.Errorf("expected signData at the limit to fit, got %v, %d", ok, size)
+	}
+	if ok, size := HeaderBudget(fitting + "x"); ok || size != 257 {
+		t.Errorf("expected signData one byte over the limit not to fit, got %v, %d", ok, size)
+	}
+	header, _ := BuildAuthHeader(fitting, "")
+	if _, size := HeaderBudget(fitting); size != len(header)+len(fitting) {
+		t.Errorf("expected the size of the built header and signData, got %d", size)
+	}
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/hmac"
+	"sync/atomic"
+)
+
+// hmacSigning selects HMAC keyed by the SK instead of hashing signData followed by the SK
+var hmacSigning atomic.Bool
+
+// SetHMACSigning makes Sign and Auth use HMAC keyed by the SK over SigningString(signData), instead of
+// the hash of SigningString(signData) immediately followed by the SK. The SK is then only handled by
+// the HMAC construction and never copied next to the application-controlled payload in a buffer, where
+// a heap dump would expose it at a predictable offset. Both sides must use the same scheme.
+func SetHMACSigning(enabled bool) {
+	hmacSigning.Store(enabled)
+	authVerifyCache.purge()
+}
+
+// hmacDigest is the HMAC of data keyed by the SK with the configured hash
+func hmacDigest(data []byte, secretKey string) []byte {
+	mac := hmac.New(getHashSpec().newHash, []byte(secretKey))
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// UseOpenSSLSigning makes Sign and Auth interoperate with the OpenSSL CLI, so that an operator can produce
+// a verifiable signature from the shell: HMAC-SHA256 keyed by the SK over signData, in the format selected.
+// With SignFormatHex, the signature is the digest printed by
+//
+//	printf '%s' "$DATA" | openssl dgst -sha256 -hmac "$SK" | awk '{print $NF}'
+//
+// and with SignFormatBase64, the output of
+//
+//	printf '%s' "$DATA" | openssl dgst -sha256 -hmac "$SK" -binary | base64
+func UseOpenSSLSigning(format SignFormat) {
+	UseSHA256()
+	SetHMACSigning(true)
+	SetSignFormat(format)
+}
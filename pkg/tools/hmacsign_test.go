@@ -0,0 +1,124 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"hash"
+	"sync"
+	"testing"
+)
+
+// recordingHash is a SHA-256 remembering every buffer written to it
+type recordingHash struct {
+	hash.Hash
+	lock    *sync.Mutex
+	written *[][]byte
+}
+
+func (h recordingHash) Write(p []byte) (int, error) {
+	h.lock.Lock()
+	*h.written = append(*h.written, bytes.Clone(p))
+	h.lock.Unlock()
+	return h.Hash.Write(p)
+}
+
+func TestHMACSigning(t *testing.T) {
+	setTestKeys(t, "ak", "secret-key")
+	SetHMACSigning(true)
+	t.Cleanup(func() { SetHMACSigning(false) })
+	mac := hmac.New(sha256.New, []byte("secret-key"))
+	mac.Write([]byte("data"))
+	if Sign("data") != (HexBase64Codec{}).Encode(mac.Sum(nil)) {
+		t.Errorf("expected the HMAC of signData keyed by the SK")
+	}
+	if !Auth(Sign("data"), "data") || !AuthBytes(Sign("data"), []byte("data")) {
+		t.Errorf("expected HMAC signatures to verify")
+	}
+	if AlgorithmDescriptor().Input != "HMAC(SK, signData)" {
+		t.Errorf("expected the descriptor to describe HMAC, got %s", AlgorithmDescriptor().Input)
+	}
+	SetHMACSigning(false)
+	if Auth(HexBase64Codec{}.Encode(mac.Sum(nil)), "data") {
+		t.Errorf("expected HMAC signatures to be rejected once disabled")
+	}
+}
+
+func TestHMACSigningDoesNotConcatenateSecret(t *testing.T) {
+	setTestKeys(t, "ak", "secret-key")
+	t.Cleanup(func() { SetHMACSigning(false) })
+	lock, written := &sync.Mutex{}, &[][]byte{}
+	if err := SetHashFunc("recording", func() hash.Hash {
+		return recordingHash{Hash: sha256.New(), lock: lock, written: written}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { UseSHA256() })
+	secret := []byte("secret-key")
+
+	Sign("data")
+	if !containsBuffer(*written, secret) {
+		t.Fatal("expected the default scheme to hash the secret appended to the data")
+	}
+
+	*written = nil
+	SetHMACSigning(true)
+	Sign("data")
+	AuthBytes(Sign("data"), []byte("data"))
+	if len(*written) == 0 {
+		t.Fatal("expected the recording hash to be used")
+	}
+	if containsBuffer(*written, secret) {
+		t.Errorf("expected no hashed buffer to hold the secret")
+	}
+}
+
+func containsBuffer(buffers [][]byte, sub []byte) bool {
+	for _, buffer := range buffers {
+		if bytes.Contains(buffer, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOpenSSLSigning(t *testing.T) {
+	setTestKeys(t, "ak", "test-secret-key")
+	t.Cleanup(func() {
+		SetHMACSigning(false)
+		SetSignatureCodec(nil)
+	})
+	const signData = "GET /api/v1/agent?id=42"
+	// printf '%s' "$DATA" | openssl dgst -sha256 -hmac test-secret-key
+	// SHA2-256(stdin)= 5988b9dc0e6c96f8d8b045772e61a997bb09929f730bae5ddc2dc3a716881f06
+	UseOpenSSLSigning(SignFormatHex)
+	const hexVector = "5988b9dc0e6c96f8d8b045772e61a997bb09929f730bae5ddc2dc3a716881f06"
+	if !Auth(hexVector, signData) {
+		t.Errorf("expected the hex output of openssl to verify")
+	}
+	if Sign(signData) != hexVector {
+		t.Errorf("expected Sign to match openssl, got %s", Sign(signData))
+	}
+
+	// printf '%s' "$DATA" | openssl dgst -sha256 -hmac test-secret-key -binary | base64
+	UseOpenSSLSigning(SignFormatBase64)
+	if !Auth("WYi53A5slvjYsEV3LmGpl7sJkp9zC65d3C3DpxaIHwY=", signData) {
+		t.Errorf("expected the base64 output of openssl to verify")
+	}
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// AuthHeaderName is the header set by SignHTTPRequest
+	AuthHeaderName = "X-Chaos-Auth"
+	// MaxSignedBodySize is the largest body SignHTTPRequest and VerifyHTTPRequest read into memory
+	MaxSignedBodySize = 1 << 20
+)
+
+var (
+	ErrRequestBodyTooLarge = errors.New("request body too large to sign")
+
+	// httpSignedHeaders are the names of the headers signed by SignHTTPRequest, host is the Host of the request
+	httpSignedHeaders atomic.Pointer[[]string]
+)
+
+func init() {
+	SetHTTPSignedHeaders("host", "content-type")
+}
+
+// SetHTTPSignedHeaders sets the headers signed by SignHTTPRequest and VerifyHTTPRequest, both sides must
+// use the same. A header missing from a request is signed as empty.
+func SetHTTPSignedHeaders(names ...string) {
+	names = append([]string(nil), names...)
+	httpSignedHeaders.Store(&names)
+}
+
+// VerifyHTTPRequest verifies a request signed by SignHTTPRequest with the in-memory keys, the body is
+// rewound so that the handler can still read it
+func VerifyHTTPRequest(req *http.Request) (bool, error) {
+	if err := checkCredentialsEnabled(); err != nil {
+		return false, err
+	}
+	header, err := ParseAuthHeader(req.Header.Get(AuthHeaderName))
+	if err != nil {
+		return false, err
+	}
+	if err := checkAKAllowed(header.AccessKey); err != nil {
+		return false, err
+	}
+	canonical, err := canonicalHTTPRequest(req)
+	if err != nil {
+		return false, err
+	}
+	if header.AccessKey != GetAccessKey() {
+		return false, nil
+	}
+	return Auth(header.Signature, canonical), nil
+}
+
+// canonicalHTTPRequest returns the CanonicalRequest of req, replacing its body by a rewindable copy
+func canonicalHTTPRequest(req *http.Request) (string, error) {
+	body, err := rewindBody(req)
+	if err != nil {
+		return "", err
+	}
+	names := *httpSignedHeaders.Load()
+	headers := make(map[string]string, len(names))
+	for _, name := range names {
+		if strings.EqualFold(name, "host") {
+			headers[name] = requestHost(req)
+			continue
+		}
+		headers[name] = strings.Join(req.Header.Values(name), ",")
+	}
+	return CanonicalRequest(req.Method, req.URL.EscapedPath(), req.URL.Query(), headers, body), nil
+}
+
+// requestHost returns the host a client sends, which is the Host a server receives
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+// rewindBody reads the body of req up to MaxSignedBodySize and replaces it with a copy
+func rewindBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	original := req.Body
+	body, err := io.ReadAll(io.LimitReader(original, MaxSignedBodySize+1))
+	if err != nil {
+		original.Close()
+		return nil, err
+	}
+	if len(body) > MaxSignedBodySize {
+		// put back what was read ahead of the rest, so that the request can still be sent unsigned
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), original), original}
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrRequestBodyTooLarge, MaxSignedBodySize)
+	}
+	original.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
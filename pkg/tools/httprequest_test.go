@@ -0,0 +1,122 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSignHTTPRequestRoundTrip(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	var verified bool
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		verified, err = VerifyHTTPRequest(r)
+		if err != nil {
+			t.Error(err)
+		}
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/agent?id=42&env=test", strings.NewReader(`{"state":"ready"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := SignHTTPRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(req.Header.Get(AuthHeaderName), "ak=ak,sign=") {
+		t.Errorf("expected the auth header to be set, got %q", req.Header.Get(AuthHeaderName))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !verified {
+		t.Errorf("expected the signed request to verify on the server")
+	}
+	if received != `{"state":"ready"}` {
+		t.Errorf("expected the body to be rewound for sending and handling, got %q", received)
+	}
+}
+
+func TestVerifyHTTPRequestTampered(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPut, "http://example.com/api?id=1", strings.NewReader("body"))
+		req.Header.Set("Content-Type", "text/plain")
+		if err := SignHTTPRequest(req); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	if ok, err := VerifyHTTPRequest(newRequest()); !ok || err != nil {
+		t.Fatalf("expected the request to verify, got %v, %v", ok, err)
+	}
+	tampered := map[string]func(req *http.Request){
+		"body":   func(req *http.Request) { req.Body = io.NopCloser(strings.NewReader("other")) },
+		"header": func(req *http.Request) { req.Header.Set("Content-Type", "application/json") },
+		"query":  func(req *http.Request) { req.URL.RawQuery = "id=2" },
+		"method": func(req *http.Request) { req.Method = http.MethodDelete },
+		"host":   func(req *http.Request) { req.Host = "other.example.com" },
+	}
+	for name, tamper := range tampered {
+		req := newRequest()
+		tamper(req)
+		if ok, err := VerifyHTTPRequest(req); ok || err != nil {
+			t.Errorf("expected a request with another %s not to verify, got %v, %v", name, ok, err)
+		}
+	}
+
+	req := newRequest()
+	req.Header.Del(AuthHeaderName)
+	if _, err := VerifyHTTPRequest(req); !errors.Is(err, ErrInvalidAuthHeader) {
+		t.Errorf("expected ErrInvalidAuthHeader without the header, got %v", err)
+	}
+}
+
+func TestSignHTTPRequestBodyLimit(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	large := bytes.Repeat([]byte("0123456789"), MaxSignedBodySize/10+1)
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/", bytes.NewReader(large))
+	if err := SignHTTPRequest(req); !errors.Is(err, ErrRequestBodyTooLarge) {
+		t.Errorf("expected ErrRequestBodyTooLarge, got %v", err)
+	}
+	if body, err := io.ReadAll(req.Body); err != nil || !bytes.Equal(body, large) {
+		t.Errorf("expected the whole body to be readable after ErrRequestBodyTooLarge, got %d bytes, %v", len(body), err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	if err := SignHTTPRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyHTTPRequest(req); !ok || err != nil {
+		t.Errorf("expected a request without body to verify, got %v, %v", ok, err)
+	}
+}
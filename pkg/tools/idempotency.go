@@ -0,0 +1,30 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// IdempotencyKey returns the key the server dedupes a request by: the hex sha256 of the access key
+// and signData as length prefixed parts. It isn't keyed on the secret key so that the server can
+// recompute it, hence it's not a signature, and it's the same on every agent sharing the access key.
+func IdempotencyKey(signData string) string {
+	sum := sha256.Sum256([]byte(partsSigningString([]string{GetAccessKey(), signData})))
+	return hex.EncodeToString(sum[:])
+}
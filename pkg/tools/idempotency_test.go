@@ -0,0 +1,43 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import "testing"
+
+func TestIdempotencyKey(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	key := IdempotencyKey("payload")
+	if len(key) != 64 || key != IdempotencyKey("payload") {
+		t.Fatalf("expected a stable hex sha256, got %s", key)
+	}
+	if IdempotencyKey("other") == key {
+		t.Errorf("expected different payloads to yield different keys")
+	}
+
+	setTestKeys(t, "ak", "other-sk")
+	if IdempotencyKey("payload") != key {
+		t.Errorf("expected the key not to depend on the secret key")
+	}
+	setTestKeys(t, "other-ak", "sk")
+	if IdempotencyKey("payload") == key {
+		t.Errorf("expected different access keys to yield different keys")
+	}
+	setTestKeys(t, "a", "sk")
+	if IdempotencyKey("kpayload") == key {
+		t.Errorf("expected the access key and payload not to run together")
+	}
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxJWKSSize bounds the JWKS document read from the server
+const maxJWKSSize = 1 << 20
+
+var (
+	ErrMalformedJWKS    = errors.New("malformed JWKS")
+	ErrUnknownVerifyKey = errors.New("unknown verify key")
+
+	// jwksRefreshInterval is the interval between two fetches of the JWKS, replaced in tests
+	jwksRefreshInterval = 10 * time.Minute
+
+	// verifyKeys holds the map[string]crypto.PublicKey of the server keys by kid
+	verifyKeys atomic.Value
+)
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// LoadVerifyKeysFromJWKS fetches the public keys of the server from its JWKS endpoint, then refreshes them every
+// jwksRefreshInterval until ctx is done, so that the server can rotate its keys. The first fetch must succeed,
+// a failed refresh keeps the last good keys. Ed25519 (OKP) and RSA keys are supported, others are skipped.
+func LoadVerifyKeysFromJWKS(ctx context.Context, url string) error {
+	keys, err := fetchJWKS(ctx, url)
+	if err != nil {
+		return err
+	}
+	verifyKeys.Store(keys)
+	interval := jwksRefreshInterval
+	ctx, done := startBackground(ctx)
+	go func() {
+		defer done()
+		defer PanicPrintStack()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			keys, err := fetchJWKS(ctx, url)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.WithField("url", url).WithError(err).Warningln("refresh JWKS failed, keep the last good keys")
+				}
+				continue
+			}
+			verifyKeys.Store(keys)
+		}
+	}()
+	return nil
+}
+
+func fetchJWKS(ctx context.Context, url string) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("response code: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(body)
+}
+
+func parseJWKS(body []byte) (map[string]crypto.PublicKey, error) {
+	set := jsonWebKeySet{}
+	if err := json.Unmarshal(body, &set); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedJWKS, err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Kid == "" {
+			return nil, fmt.Errorf("%w: key without kid", ErrMalformedJWKS)
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %s: %v", ErrMalformedJWKS, jwk.Kid, err)
+		}
+		if key == nil {
+			log.WithField("kid", jwk.Kid).Debugf("skip unsupported JWKS key type %s", jwk.Kty)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no supported key", ErrMalformedJWKS)
+	}
+	return keys, nil
+}
+
+// publicKey decodes the key, nil if its type isn't supported
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch {
+	case jwk.Kty == "OKP" && jwk.Crv == "Ed25519":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size %d", len(x))
+		}
+		return ed25519.PublicKey(x), nil
+	case jwk.Kty == "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// VerifyServerSignature verifies the standard base64 signature of data by the server key kid of the JWKS:
+// Ed25519 over the data, or RSA PKCS #1 v1.5 over its SHA-256
+func VerifyServerSignature(kid string, data []byte, signature string) error {
+	if err := checkCredentialsEnabled(); err != nil {
+		return err
+	}
+	keys, _ := verifyKeys.Load().(map[string]crypto.PublicKey)
+	key, ok := keys[kid]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownVerifyKey, kid)
+	}
+	return verifyPublicKeySignature(key, data, signature)
+}
+
+// verifyPublicKeySignature verifies the standard base64 signature of data by an Ed25519 or RSA public key
+func verifyPublicKeySignature(key crypto.PublicKey, data []byte, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedSignature, err)
+	}
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, data, sig) {
+			return ErrSignMismatch
+		}
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(data)
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig) != nil {
+			return ErrSignMismatch
+		}
+	default:
+		return fmt.Errorf("unsupported public key %T", key)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeJWKSServer serves the current keys, or a server error while failing
+type fakeJWKSServer struct {
+	lock    sync.Mutex
+	keys    []jsonWebKey
+	failing bool
+}
+
+func (server *fakeJWKSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if server.failing {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(jsonWebKeySet{Keys: server.keys})
+}
+
+func (server *fakeJWKSServer) set(failing bool, keys ...jsonWebKey) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	server.failing = failing
+	if keys != nil {
+		server.keys = keys
+	}
+}
+
+func newTestEd25519Key(t *testing.T, kid string) (ed25519.PrivateKey, jsonWebKey) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return private, jsonWebKey{Kty: "OKP", Crv: "Ed25519", Kid: kid, X: base64.RawURLEncoding.EncodeToString(public)}
+}
+
+func startTestJWKS(t *testing.T, interval time.Duration, keys ...jsonWebKey) (*fakeJWKSServer, string) {
+	t.Helper()
+	verifyKeys.Store(map[string]crypto.PublicKey(nil))
+	t.Cleanup(func() { verifyKeys.Store(map[string]crypto.PublicKey(nil)) })
+	previous := jwksRefreshInterval
+	jwksRefreshInterval = interval
+	t.Cleanup(func() { jwksRefreshInterval = previous })
+	fake := &fakeJWKSServer{keys: keys}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server.URL
+}
+
+func signEd25519(key ed25519.PrivateKey, data string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(data)))
+}
+
+func TestLoadVerifyKeysFromJWKS(t *testing.T) {
+	key, jwk := newTestEd25519Key(t, "k1")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaJWK := jsonWebKey{
+		Kty: "RSA",
+		Kid: "r1",
+		N:   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}
+	unsupported := jsonWebKey{Kty: "EC", Crv: "P-256", Kid: "e1"}
+	_, url := startTestJWKS(t, time.Hour, jwk, rsaJWK, unsupported)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := LoadVerifyKeysFromJWKS(ctx, url); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyServerSignature("k1", []byte("data"), signEd25519(key, "data")); err != nil {
+		t.Errorf("expected the Ed25519 signature to verify, got %v", err)
+	}
+	if err := VerifyServerSignature("k1", []byte("other"), signEd25519(key, "data")); !errors.Is(err, ErrSignMismatch) {
+		t.Errorf("expected ErrSignMismatch, got %v", err)
+	}
+	sum := sha256.Sum256([]byte("data"))
+	rsaSig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyServerSignature("r1", []byte("data"), base64.StdEncoding.EncodeToString(rsaSig)); err != nil {
+		t.Errorf("expected the RSA signature to verify, got %v", err)
+	}
+	if err := VerifyServerSignature("e1", []byte("data"), signEd25519(key, "data")); !errors.Is(err, ErrUnknownVerifyKey) {
+		t.Errorf("expected the unsupported key to be skipped, got %v", err)
+	}
+}
+
+func TestLoadVerifyKeysFromJWKSErrors(t *testing.T) {
+	fake, url := startTestJWKS(t, time.Hour)
+	fake.set(true)
+	if err := LoadVerifyKeysFromJWKS(context.Background(), url); err == nil {
+		t.Errorf("expected the first fetch failure to be returned")
+	}
+	fake.set(false, jsonWebKey{Kty: "OKP", Crv: "Ed25519", Kid: "k1", X: "short"})
+	if err := LoadVerifyKeysFromJWKS(context.Background(), url); !errors.Is(err, ErrMalformedJWKS) {
+		t.Errorf("expected ErrMalformedJWKS, got %v", err)
+	}
+}
+
+func TestLoadVerifyKeysFromJWKSRotation(t *testing.T) {
+	oldKey, oldJWK := newTestEd25519Key(t, "old")
+	newKey, newJWK := newTestEd25519Key(t, "new")
+	fake, url := startTestJWKS(t, 5*time.Millisecond, oldJWK)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	captureLog(t)
+	if err := LoadVerifyKeysFromJWKS(ctx, url); err != nil {
+		t.Fatal(err)
+	}
+
+	// failed refreshes keep the last good keys
+	fake.set(true)
+	time.Sleep(30 * time.Millisecond)
+	if err := VerifyServerSignature("old", []byte("data"), signEd25519(oldKey, "data")); err != nil {
+		t.Fatalf("expected the last good keys to be kept, got %v", err)
+	}
+
+	fake.set(false, newJWK)
+	deadline := time.Now().Add(time.Second)
+	for VerifyServerSignature("new", []byte("data"), signEd25519(newKey, "data")) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the rotated key to be fetched")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := VerifyServerSignature("old", []byte("data"), signEd25519(oldKey, "data")); !errors.Is(err, ErrUnknownVerifyKey) {
+		t.Errorf("expected the retired key to be dropped, got %v", err)
+	}
+}
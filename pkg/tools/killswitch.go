@@ -0,0 +1,79 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrCredentialsDisabled = errors.New("credentials disabled")
+	ErrNotReloadable       = errors.New("credentials can't be reloaded from their source")
+
+	// credentialsDisabled makes Sign and Auth fail closed until Enable
+	credentialsDisabled atomic.Bool
+)
+
+// checkCredentialsEnabled returns ErrCredentialsDisabled while Disable is in force
+func checkCredentialsEnabled() error {
+	if credentialsDisabled.Load() {
+		return ErrCredentialsDisabled
+	}
+	return nil
+}
+
+// Disable is the kill switch of a compromised agent: the in-memory keys are zeroed and every sign and
+// verify entry point fails with ErrCredentialsDisabled, or fails closed without error, until Enable, even
+// if keys are set again meanwhile. The files are kept.
+func Disable() {
+	credentialsDisabled.Store(true)
+	defaultManager.forgetCertFile()
+	// the source is kept for Enable
+	defaultManager.swap(Credentials{}, nil, nil)
+	authVerifyCache.purge()
+	log.Warningln("credentials disabled, sign and auth fail until enabled")
+}
+
+// Enable reloads the keys from where they were loaded, the cert file in its format, the keyring, the
+// environment, a profile or a provider, and lifts Disable. It stays disabled if they can't be reloaded.
+// Keys of a source that can't be read again, like a FIFO, an encrypted cert file or a derived key, are
+// rejected with ErrNotReloadable, EnableWith reloads them.
+func Enable() error {
+	_, source := defaultManager.loadedFrom()
+	if source.reload == nil {
+		return fmt.Errorf("%w: the keys come from the %s, enable with a loader", ErrNotReloadable, source)
+	}
+	return EnableWith(source.reload)
+}
+
+// EnableWith reloads the keys with load, e.g. LoadSecretKeyEncrypted with the KEK, and lifts Disable.
+// It stays disabled if load fails or loads no keys.
+func EnableWith(load func() error) error {
+	if err := load(); err != nil {
+		return err
+	}
+	if GetAccessKey() == "" || GetSecureKey() == "" {
+		return errors.New("accessKey or secretKey is empty")
+	}
+	credentialsDisabled.Store(false)
+	log.Infoln("credentials enabled")
+	return nil
+}
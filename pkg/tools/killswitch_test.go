@@ -0,0 +1,253 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDisableEnable(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	t.Cleanup(func() { credentialsDisabled.Store(false) })
+	EnableVerifyCache(time.Minute, 16)
+	defer EnableVerifyCache(0, 0)
+	captureLog(t)
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	sign := Sign("data")
+	if !Auth(sign, "data") {
+		t.Fatal("expected the signature to verify before disabling")
+	}
+
+	Disable()
+	if GetAccessKey() != "" || GetSecureKey() != "" {
+		t.Errorf("expected the in-memory keys to be zeroed")
+	}
+	if _, err := os.Stat(certFile); err != nil {
+		t.Errorf("expected the cert file to be kept, got %v", err)
+	}
+	if err := AuthErr(sign, "data"); !errors.Is(err, ErrCredentialsDisabled) {
+		t.Errorf("expected auth to fail closed, got %v", err)
+	}
+	if _, err := SignErr("data"); !errors.Is(err, ErrCredentialsDisabled) {
+		t.Errorf("expected sign to fail closed, got %v", err)
+	}
+	if err := LoadSecretKeyFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	if Auth(sign, "data") || Sign("data") != "" {
+		t.Errorf("expected keys loaded while disabled not to be used")
+	}
+
+	if err := Enable(); err != nil {
+		t.Fatal(err)
+	}
+	if !Auth(sign, "data") || Sign("data") != sign {
+		t.Errorf("expected sign and auth to resume after enable")
+	}
+}
+
+func TestEnableWithoutCertFile(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	setTestFiles(t)
+	t.Cleanup(func() { credentialsDisabled.Store(false) })
+	captureLog(t)
+	Disable()
+	if err := Enable(); err == nil {
+		t.Fatal("expected enable to fail without cert file")
+	}
+	if _, err := SignErr("data"); !errors.Is(err, ErrCredentialsDisabled) {
+		t.Errorf("expected to stay disabled, got %v", err)
+	}
+}
+
+func TestEnableReloadsSource(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	t.Cleanup(func() { credentialsDisabled.Store(false) })
+	captureLog(t)
+	t.Setenv(AccessKeyEnv, "ak-env")
+	t.Setenv(SecretKeyEnv, "sk-env")
+	profilesFile := writeTestProfiles(t, map[string]Credentials{"default": {AccessKey: "ak-profile", SecretKey: "sk-profile"}})
+	sources := map[string]func() error{
+		"text":    func() error { return RecordSecretKeyToFile("ak-text", "sk-text") },
+		"binary":  func() error { return RecordSecretKeyBinary("ak-binary", "sk-binary") },
+		"env":     LoadSecretKeyFromEnv,
+		"profile": func() error { return UseProfile(profilesFile, "default") },
+		"store": func() error {
+			if err := (FileStore{}).Save(Credentials{AccessKey: "ak-store", SecretKey: "sk-store"}); err != nil {
+				return err
+			}
+			return InitCredentials(FileStore{})
+		},
+		"provider": func() error {
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			return RefreshCredentials(ctx, &rotatingProvider{}, 0)
+		},
+	}
+	for name, load := range sources {
+		t.Run(name, func(t *testing.T) {
+			if err := load(); err != nil {
+				t.Fatal(err)
+			}
+			accessKey := GetAccessKey()
+			Disable()
+			if err := Enable(); err != nil {
+				t.Fatal(err)
+			}
+			if GetAccessKey() != accessKey || Sign("data") == "" {
+				t.Errorf("expected the keys of the %s to be reloaded, got %q", name, GetAccessKey())
+			}
+		})
+	}
+
+	kek := make([]byte, 32)
+	if err := RecordSecretKeyEncrypted("ak-encrypted", "sk-encrypted", kek); err != nil {
+		t.Fatal(err)
+	}
+	Disable()
+	if err := Enable(); !errors.Is(err, ErrNotReloadable) {
+		t.Errorf("expected ErrNotReloadable without the KEK, got %v", err)
+	}
+	if err := EnableWith(func() error { return LoadSecretKeyEncrypted(kek) }); err != nil {
+		t.Fatal(err)
+	}
+	if GetAccessKey() != "ak-encrypted" || Sign("data") == "" {
+		t.Errorf("expected the encrypted keys to be reloaded by the loader, got %q", GetAccessKey())
+	}
+}
+
+// TestDisableEntryPoints checks that every sign and verify entry point fails closed while disabled,
+// even with keys set again meanwhile
+func TestDisableEntryPoints(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	t.Cleanup(func() { credentialsDisabled.Store(false) })
+	captureLog(t)
+	sign := Sign("data")
+	token, err := SignClaims(map[string]interface{}{"aud": "server"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := BuildAuthHeader("data", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	AllowSecretBundleExport(true)
+	t.Cleanup(func() { AllowSecretBundleExport(false) })
+	setTestFiles(t)
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := ExportVerifyBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookup := func(string) (string, error) { return "sk", nil }
+	request := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.Header.Set(AuthHeaderName, header)
+		return req
+	}
+
+	Disable()
+	setCredentials("ak", "sk")
+	tests := map[string]func() error{
+		"Sign": func() error {
+			_, err := SignErr("data")
+			return err
+		},
+		"Auth": func() error { return AuthErr(sign, "data") },
+		"AuthCtx": func() error {
+			if AuthCtx(WithSecretKey(context.Background(), "sk"), sign, "data") {
+				return nil
+			}
+			return ErrCredentialsDisabled
+		},
+		"VerifyFor": func() error {
+			_, err := VerifyFor("ak", sign, "data", lookup)
+			return err
+		},
+		"VerifyAuthHeader": func() error {
+			_, err := VerifyAuthHeader(header, "data", func(string) (string, string, error) {
+				return "ak", "sk", nil
+			})
+			return err
+		},
+		"BuildAuthHeader": func() error {
+			_, err := BuildAuthHeader("data", "")
+			return err
+		},
+		"SignClaims": func() error {
+			_, err := SignClaims(map[string]interface{}{"aud": "server"})
+			return err
+		},
+		"VerifyClaims": func() error {
+			_, err := VerifyClaims(token)
+			return err
+		},
+		"DiagnoseMismatch": func() error {
+			if report := DiagnoseMismatch("data", sign); report.Disabled && !report.Matched {
+				return ErrCredentialsDisabled
+			}
+			return nil
+		},
+		"MigrationCompare": func() error {
+			if legacy, modern, _ := MigrationCompare("data"); legacy == "" && modern == "" {
+				return ErrCredentialsDisabled
+			}
+			return nil
+		},
+		"SignAll": func() error {
+			if len(SignAll("data")) == 0 {
+				return ErrCredentialsDisabled
+			}
+			return nil
+		},
+		"ExportVerifyBundle": func() error {
+			_, err := ExportVerifyBundle()
+			return err
+		},
+		"VerifyWithBundle": func() error {
+			_, err := VerifyWithBundle(bundle, "ak", sign, "data")
+			return err
+		},
+		"VerifyServerSignature": func() error {
+			return VerifyServerSignature("kid", []byte("data"), "c2lnbg==")
+		},
+		"SignHTTPRequest": func() error { return SignHTTPRequest(request()) },
+		"VerifyHTTPRequest": func() error {
+			_, err := VerifyHTTPRequest(request())
+			return err
+		},
+	}
+	for name, call := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := call(); !errors.Is(err, ErrCredentialsDisabled) {
+				t.Errorf("expected %s to fail closed while disabled, got %v", name, err)
+			}
+		})
+	}
+}
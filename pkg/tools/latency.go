@@ -0,0 +1,146 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// latencySubBuckets is the number of buckets per power of two, the relative error is below 1/32
+	latencySubBuckets = 16
+	latencyBuckets    = latencySubBuckets * 61
+)
+
+// LatencyRecorder is a LatencyObserver decorator keeping the distribution of the Auth latencies in HDR-style
+// log-linear buckets of fixed memory: recording is lock-free and doesn't allocate, and a percentile is
+// accurate to a few percent. Sign latencies are only forwarded.
+type LatencyRecorder struct {
+	next    LatencyObserver
+	count   atomic.Uint64
+	buckets [latencyBuckets]atomic.Uint64
+}
+
+// NewLatencyRecorder returns a recorder forwarding the observations to next, which may be nil
+func NewLatencyRecorder(next LatencyObserver) *LatencyRecorder {
+	if next == nil {
+		next = noopLatencyObserver{}
+	}
+	return &LatencyRecorder{next: next}
+}
+
+func (recorder *LatencyRecorder) ObserveSign(d time.Duration) {
+	recorder.next.ObserveSign(d)
+}
+
+func (recorder *LatencyRecorder) ObserveAuth(d time.Duration) {
+	recorder.Record(d)
+	recorder.next.ObserveAuth(d)
+}
+
+// Record adds a latency to the distribution
+func (recorder *LatencyRecorder) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	recorder.buckets[latencyBucket(uint64(d))].Add(1)
+	recorder.count.Add(1)
+}
+
+// Percentile returns the latency below which the fraction p of the recorded ones are, 0 if none was recorded
+func (recorder *LatencyRecorder) Percentile(p float64) time.Duration {
+	count := recorder.count.Load()
+	if count == 0 {
+		return 0
+	}
+	rank := uint64(p*float64(count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	seen := uint64(0)
+	for index := range recorder.buckets {
+		seen += recorder.buckets[index].Load()
+		if seen >= rank {
+			lower, upper := latencyBucketBounds(index)
+			return time.Duration(lower + (upper-lower)/2)
+		}
+	}
+	// recorded concurrently with the scan
+	lower, _ := latencyBucketBounds(latencyBuckets - 1)
+	return time.Duration(lower)
+}
+
+// Percentiles returns the Percentile of each of ps
+func (recorder *LatencyRecorder) Percentiles(ps ...float64) map[float64]time.Duration {
+	percentiles := make(map[float64]time.Duration, len(ps))
+	for _, p := range ps {
+		percentiles[p] = recorder.Percentile(p)
+	}
+	return percentiles
+}
+
+// Reset forgets the recorded latencies
+func (recorder *LatencyRecorder) Reset() {
+	for index := range recorder.buckets {
+		recorder.buckets[index].Store(0)
+	}
+	recorder.count.Store(0)
+}
+
+// latencyBucket returns the bucket of v nanoseconds: v itself below latencySubBuckets, otherwise its
+// power of two and its next 4 most significant bits
+func latencyBucket(v uint64) int {
+	if v < latencySubBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(v) - 5
+	return latencySubBuckets*(shift+1) + int(v>>shift) - latencySubBuckets
+}
+
+// latencyBucketBounds returns the range [lower, upper) of the nanoseconds in the bucket
+func latencyBucketBounds(index int) (lower, upper uint64) {
+	if index < latencySubBuckets {
+		return uint64(index), uint64(index) + 1
+	}
+	shift := index/latencySubBuckets - 1
+	mantissa := uint64(latencySubBuckets + index%latencySubBuckets)
+	return mantissa << shift, (mantissa + 1) << shift
+}
+
+// authLatencyRecorder is the recorder installed by EnableLatencyPercentiles, nil if none
+var authLatencyRecorder atomic.Pointer[LatencyRecorder]
+
+// EnableLatencyPercentiles installs a LatencyRecorder decorating the current LatencyObserver, so that
+// LatencyPercentiles reports the Auth latencies, e.g. for agent doctor
+func EnableLatencyPercentiles() *LatencyRecorder {
+	recorder := NewLatencyRecorder(getLatencyObserver())
+	SetLatencyObserver(recorder)
+	authLatencyRecorder.Store(recorder)
+	return recorder
+}
+
+// LatencyPercentiles returns the p50, p90 and p99 of the Auth latencies since EnableLatencyPercentiles,
+// nil if it wasn't called
+func LatencyPercentiles() map[float64]time.Duration {
+	recorder := authLatencyRecorder.Load()
+	if recorder == nil {
+		return nil
+	}
+	return recorder.Percentiles(0.5, 0.9, 0.99)
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestLatencyBuckets(t *testing.T) {
+	for _, v := range []uint64{0, 1, 15, 16, 17, 31, 32, 33, 1000, 123456789, math.MaxInt64} {
+		lower, upper := latencyBucketBounds(latencyBucket(v))
+		if v < lower || v >= upper {
+			t.Errorf("expected %d in [%d, %d)", v, lower, upper)
+		}
+	}
+}
+
+func TestLatencyRecorderPercentiles(t *testing.T) {
+	recorder := NewLatencyRecorder(nil)
+	if recorder.Percentile(0.5) != 0 {
+		t.Errorf("expected 0 without latency")
+	}
+	// 1 to 10000 microseconds in random order
+	for _, i := range rand.Perm(10000) {
+		recorder.Record(time.Duration(i+1) * time.Microsecond)
+	}
+	for p, expected := range map[float64]time.Duration{
+		0.5:  5000 * time.Microsecond,
+		0.9:  9000 * time.Microsecond,
+		0.99: 9900 * time.Microsecond,
+	} {
+		if actual := recorder.Percentile(p); math.Abs(float64(actual-expected)) > 0.04*float64(expected) {
+			t.Errorf("expected p%v about %v, got %v", p*100, expected, actual)
+		}
+	}
+	recorder.Reset()
+	if recorder.Percentile(0.99) != 0 {
+		t.Errorf("expected reset to forget the latencies")
+	}
+}
+
+func TestLatencyPercentilesFedByAuth(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	observer := &fakeLatencyObserver{}
+	SetLatencyObserver(observer)
+	defer SetLatencyObserver(nil)
+	defer authLatencyRecorder.Store(nil)
+	if LatencyPercentiles() != nil {
+		t.Fatal("expected no percentiles before enabling")
+	}
+	EnableLatencyPercentiles()
+	for i := 0; i < 10; i++ {
+		Auth(Sign("data"), "data")
+	}
+	percentiles := LatencyPercentiles()
+	if len(percentiles) != 3 || percentiles[0.99] <= 0 || percentiles[0.5] > percentiles[0.99] {
+		t.Errorf("unexpected percentiles %v", percentiles)
+	}
+	observer.lock.Lock()
+	defer observer.lock.Unlock()
+	if len(observer.auths) != 10 || len(observer.signs) != 10 {
+		t.Errorf("expected the observations to be forwarded, got %d auths and %d signs", len(observer.auths), len(observer.signs))
+	}
+}
+
+func BenchmarkLatencyRecorder(b *testing.B) {
+	recorder := NewLatencyRecorder(nil)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		d := time.Duration(0)
+		for pb.Next() {
+			d += time.Microsecond
+			recorder.Record(d)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/sha1"
+	"sync/atomic"
+)
+
+// legacySHA1Verification enables Auth to accept the SHA-1 signatures of very old agents
+var legacySHA1Verification atomic.Bool
+
+// SetLegacySHA1Verification enables Auth to fall back to the SHA-1 digest in the HexBase64Codec format
+// signed by very old agents when the primary verification fails. Each accepted signature is logged with
+// the AK so that those agents can be tracked and retired, it's disabled once they're decommissioned.
+func SetLegacySHA1Verification(enabled bool) {
+	legacySHA1Verification.Store(enabled)
+}
+
+// legacySHA1Digest is the digest of the old agents: SHA-1 over the data followed by the SK
+func legacySHA1Digest(data []byte, secretKey string) []byte {
+	h := sha1.New()
+	h.Write(data)
+	h.Write([]byte(secretKey))
+	return h.Sum(nil)
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLegacySHA1Verification(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	t.Cleanup(func() { SetLegacySHA1Verification(false) })
+	signature := HexBase64Codec{}.Encode(legacySHA1Digest([]byte("data"), "sk"))
+
+	if Auth(signature, "data") || AuthBytes(signature, []byte("data")) {
+		t.Fatalf("expected a SHA-1 signature to be rejected by default")
+	}
+	SetLegacySHA1Verification(true)
+	if !Auth(signature, "data") || !AuthBytes(signature, []byte("data")) {
+		t.Errorf("expected a SHA-1 signature to verify in legacy mode")
+	}
+	if Auth(signature, "other") {
+		t.Errorf("expected a SHA-1 signature of other data to be rejected in legacy mode")
+	}
+	if !Auth(Sign("data"), "data") {
+		t.Errorf("expected the primary signature to verify in legacy mode")
+	}
+
+	SetSignatureCodec(Base64Codec{})
+	t.Cleanup(func() { SetSignatureCodec(nil) })
+	if !Auth(signature, "data") {
+		t.Errorf("expected a SHA-1 signature to verify in legacy mode whatever the codec")
+	}
+	SetLegacySHA1Verification(false)
+	if Auth(signature, "data") {
+		t.Errorf("expected a SHA-1 signature to be rejected once legacy mode is disabled")
+	}
+}
+
+func TestLegacySHA1VerificationLogsAccessKey(t *testing.T) {
+	setTestKeys(t, "old-agent", "sk")
+	t.Cleanup(func() { SetLegacySHA1Verification(false) })
+	SetLegacySHA1Verification(true)
+	output := captureLog(t)
+	if !Auth(HexBase64Codec{}.Encode(legacySHA1Digest([]byte("data"), "sk")), "data") {
+		t.Fatal("expected a SHA-1 signature to verify in legacy mode")
+	}
+	if !strings.Contains(output.String(), "old-agent") {
+		t.Errorf("expected the AK to be logged, got %q", output.String())
+	}
+}
@@ -0,0 +1,213 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CredentialManager owns the in-memory AK/SK, the callbacks notified when they change and the state
+// of the cert file they were loaded from, so that the components of a process share one consistent view.
+// The package-level functions delegate to DefaultManager.
+type CredentialManager struct {
+	// credentials holds an immutable Credentials, read without locking on the hot path and
+	// replaced as a whole under lock
+	credentials atomic.Value
+	lock        sync.RWMutex
+	callbacks   []func(ak string)
+	// expiry of time-limited credentials, zero if they don't expire
+	expiry time.Time
+	// policy holds the KeyPolicy of the credentials
+	policy atomic.Value
+
+	// certFile is the state of the cert file the keys come from, nil if they weren't loaded from a file
+	certFile *certFileState
+	// source is where the keys were loaded from
+	source credentialSource
+}
+
+var defaultManager = &CredentialManager{}
+
+// DefaultManager returns the manager of the process-wide credentials
+func DefaultManager() *CredentialManager {
+	return defaultManager
+}
+
+// Credentials returns the AK and the SK read together, so that a concurrent rotation can't be observed half done
+func (m *CredentialManager) Credentials() Credentials {
+	creds, _ := m.credentials.Load().(Credentials)
+	return creds
+}
+
+// AccessKey returns the in-memory AK
+func (m *CredentialManager) AccessKey() string {
+	return m.Credentials().AccessKey
+}
+
+// SecretKey returns the in-memory SK
+func (m *CredentialManager) SecretKey() string {
+	return m.Credentials().SecretKey
+}
+
+// OnLoaded registers a callback invoked with the AK whenever the keys become available or are rotated
+func (m *CredentialManager) OnLoaded(callback func(ak string)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.callbacks = append(m.callbacks, callback)
+}
+
+// Set replaces the in-memory keys and notifies the OnLoaded callbacks if they changed, the policy of
+// keys that changed is reset. An SK weaker than SetMinSecretStrength is rejected with ErrWeakSecret.
+// The keys are only held in memory, they're never persisted to the cert file.
+func (m *CredentialManager) Set(accessKey, secretKey string) error {
+	return m.setFrom(credentialSource{}, accessKey, secretKey)
+}
+
+// setFrom is Set for keys loaded from source
+func (m *CredentialManager) setFrom(source credentialSource, accessKey, secretKey string) error {
+	creds := Credentials{AccessKey: accessKey, SecretKey: secretKey}
+	changed := creds != m.Credentials()
+	if err := m.swap(creds, nil, &source); err != nil {
+		return err
+	}
+	if changed {
+		m.SetPolicy(PolicySignAndVerify)
+	}
+	return nil
+}
+
+// swap replaces the keys with fully built credentials in a single store, so that a concurrent Auth
+// sees either the old or the new keys and never missing or partial ones. The expiry is replaced along
+// if not nil, otherwise it's reset when the keys change, and so is the source if not nil. Empty keys are
+// always accepted, they zero the keys, a weak SK isn't.
+func (m *CredentialManager) swap(creds Credentials, expiry *time.Time, source *credentialSource) error {
+	if creds.SecretKey != "" {
+		if err := checkSecretStrength(creds.SecretKey); err != nil {
+			return err
+		}
+	}
+	m.lock.Lock()
+	changed := creds != m.Credentials()
+	m.credentials.Store(creds)
+	if expiry != nil {
+		m.expiry = *expiry
+	} else if changed {
+		m.expiry = time.Time{}
+	}
+	if source != nil {
+		m.source = *source
+	}
+	callbacks := m.callbacks
+	m.lock.Unlock()
+	if changed {
+		authVerifyCache.purge()
+	}
+	if !changed || creds.AccessKey == "" || creds.SecretKey == "" {
+		return nil
+	}
+	for _, callback := range callbacks {
+		callback(creds.AccessKey)
+	}
+	return nil
+}
+
+// Load reads the keys from the cert file and remembers the file state, the keys are swapped in
+// only once fully read so that reloading doesn't disturb concurrent verifications
+func (m *CredentialManager) Load() error {
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return err
+	}
+	data, err := readMapFromFile(certFile)
+	if err != nil {
+		return err
+	}
+	_, hasAppInstance := data[AppInstanceKeyName]
+	_, hasAppGroup := data[AppGroupKeyName]
+	if hasAppInstance || hasAppGroup {
+		log.WithField("file", certFile).Warningln("cert file contains application info, please check it isn't the app file")
+	}
+	accessKey, secretKey := data[AccessKeyName], data[SecretKeyName]
+	if accessKey == "" || secretKey == "" {
+		return fmt.Errorf("accessKey or secretKey is empty in %s", certFile)
+	}
+	expiry, err := parseExpiry(data[ExpiryKeyName])
+	if err != nil {
+		log.WithField("file", certFile).WithError(err).Warningln("ignore invalid credential expiry")
+	}
+	policy, err := parseKeyPolicy(data[PolicyKeyName])
+	if err != nil {
+		// restrict rather than grant what wasn't understood
+		log.WithField("file", certFile).WithError(err).Warningln("unknown key policy, keys are verify-only")
+	}
+	if err := checkSecretStrength(secretKey); err != nil {
+		return fmt.Errorf("%w in %s", err, certFile)
+	}
+	m.recordCertFile(certFile)
+	m.SetPolicy(policy)
+	source := certFileSource(certFile, certFormatText)
+	return m.swap(Credentials{AccessKey: accessKey, SecretKey: secretKey}, &expiry, &source)
+}
+
+// recordCertFile remembers the content hash of the cert file the keys come from
+func (m *CredentialManager) recordCertFile(certFile string) {
+	state, err := statCertFile(certFile)
+	if err != nil {
+		log.WithField("file", certFile).WithError(err).Warningln("record cert file state failed")
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.certFile = state
+}
+
+// loadedFrom returns the keys and where they were loaded from, read together
+func (m *CredentialManager) loadedFrom() (Credentials, credentialSource) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.Credentials(), m.source
+}
+
+func (m *CredentialManager) forgetCertFile() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.certFile = nil
+}
+
+// FileUnchanged returns whether the cert file still has the content it had when the keys were loaded
+// from or written to it, see CredentialFileUnchanged
+func (m *CredentialManager) FileUnchanged() (bool, error) {
+	m.lock.RLock()
+	loaded := m.certFile
+	m.lock.RUnlock()
+	if loaded == nil {
+		return false, errors.New("credentials were not loaded from the cert file")
+	}
+	current, err := statCertFile(loaded.path)
+	if err != nil {
+		return false, err
+	}
+	if !current.modTime.Equal(loaded.modTime) && current.hash == loaded.hash {
+		log.WithField("file", loaded.path).Debugln("cert file touched without content change")
+	}
+	return current.hash == loaded.hash, nil
+}
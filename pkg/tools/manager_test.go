@@ -0,0 +1,144 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCredentialManagerConcurrentAccess(t *testing.T) {
+	manager := &CredentialManager{}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				manager.Set(fmt.Sprintf("ak%d", j), fmt.Sprintf("sk%d", j))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				creds := manager.Credentials()
+				if creds.AccessKey == "" {
+					continue
+				}
+				if "s"+creds.AccessKey[1:] != creds.SecretKey {
+					t.Errorf("observed mismatched credentials %+v", creds)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if creds := manager.Credentials(); creds.AccessKey != "ak99" || creds.SecretKey != "sk99" {
+		t.Errorf("expected the last credentials, got %+v", creds)
+	}
+}
+
+func TestDefaultManagerBacksPackageFunctions(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	if creds := DefaultManager().Credentials(); creds.AccessKey != "ak" || creds.SecretKey != "sk" {
+		t.Errorf("expected the recorded credentials, got %+v", creds)
+	}
+	if GetAccessKey() != "ak" || GetSecureKey() != "sk" {
+		t.Errorf("expected the package functions to read the default manager")
+	}
+	unchanged, err := DefaultManager().FileUnchanged()
+	if err != nil || !unchanged {
+		t.Errorf("expected the cert file to be unchanged, got %v, %v", unchanged, err)
+	}
+}
+
+func TestReloadDoesNotDisturbAuth(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	captureLog(t)
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	sign := Sign("data")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			if err := LoadSecretKeyFromFile(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	failures := 0
+	for {
+		select {
+		case <-done:
+			if failures > 0 {
+				t.Errorf("expected no auth failure during reload, got %d", failures)
+			}
+			return
+		default:
+		}
+		if !Auth(sign, "data") {
+			failures++
+		}
+	}
+}
+
+// rwMutexCredentials is the RWMutex guarded storage the manager used before, kept as the benchmark baseline
+type rwMutexCredentials struct {
+	lock      sync.RWMutex
+	accessKey string
+	secretKey string
+}
+
+func (c *rwMutexCredentials) Credentials() Credentials {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return Credentials{AccessKey: c.accessKey, SecretKey: c.secretKey}
+}
+
+func BenchmarkGetCredentialsParallel(b *testing.B) {
+	b.Run("atomic", func(b *testing.B) {
+		manager := &CredentialManager{}
+		manager.Set("ak", "sk")
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if manager.Credentials().SecretKey == "" {
+					b.Error("expected the SK")
+				}
+			}
+		})
+	})
+	b.Run("rwmutex", func(b *testing.B) {
+		creds := &rwMutexCredentials{accessKey: "ak", secretKey: "sk"}
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if creds.Credentials().SecretKey == "" {
+					b.Error("expected the SK")
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MigrateCredentialFile rewrites a legacy cert file, readable by others, with owner only permissions
+// through a temp file renamed over it. A missing or already secure cert file is left untouched, so
+// it's safe to call on every start.
+func MigrateCredentialFile() error {
+	return migrateCredentialFile(nil)
+}
+
+// MigrateCredentialFileEncrypted migrates the cert file like MigrateCredentialFile and encrypts a plaintext
+// one under kek like RecordSecretKeyEncrypted, to be loaded with LoadSecretKeyEncrypted afterwards. An
+// encrypted cert file with owner only permissions is left untouched.
+func MigrateCredentialFileEncrypted(kek []byte) error {
+	if _, err := newCertAEAD(kek); err != nil {
+		return err
+	}
+	return migrateCredentialFile(kek)
+}
+
+// migrateCredentialFile migrates the cert file, encrypting it under kek unless nil
+func migrateCredentialFile(kek []byte) error {
+	if skip, err := skipPersistence(); skip {
+		return err
+	}
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return err
+	}
+	migrated, err := migrateCertFile(certFile, kek)
+	if err != nil || !migrated {
+		return err
+	}
+	if creds, source := defaultManager.loadedFrom(); source.kind == sourceCertFile && source.certFile == certFile {
+		recordCertFileState(certFile)
+		if kek != nil {
+			encrypted := certFileSource(certFile, certFormatEncrypted)
+			return defaultManager.swap(creds, nil, &encrypted)
+		}
+	}
+	return nil
+}
+
+// migrateCertFile reads and replaces certFile under the mutex, so that a concurrent write isn't lost
+func migrateCertFile(certFile string, kek []byte) (bool, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	info, err := os.Stat(certFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	content, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return false, err
+	}
+	secure := info.Mode().Perm()&0o077 == 0
+	encrypted := bytes.HasPrefix(content, []byte(encryptedCertMagic))
+	if secure && (kek == nil || encrypted) {
+		return false, nil
+	}
+	if !encrypted && !bytes.HasPrefix(content, []byte(binaryCertMagic)) {
+		if content, err = migrateTextCert(certFile, kek); err != nil {
+			return false, err
+		}
+	}
+	if err := replaceFile(certFile, content, 0o600); err != nil {
+		return false, err
+	}
+	entry := log.WithField("file", certFile)
+	if !secure {
+		entry.Infof("migrate cert file permissions from %o to 600", info.Mode().Perm())
+	}
+	if kek != nil && !encrypted {
+		entry.Infoln("migrate cert file to the encrypted format")
+	}
+	return true, nil
+}
+
+// migrateTextCert returns the content of the text cert file certFile, encrypted under kek unless nil
+func migrateTextCert(certFile string, kek []byte) ([]byte, error) {
+	data, err := readMapFromFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	if data[AccessKeyName] == "" || data[SecretKeyName] == "" {
+		return nil, fmt.Errorf("accessKey or secretKey is empty in %s", certFile)
+	}
+	if kek == nil {
+		return getFileCodec().Marshal(data)
+	}
+	plaintext := encodeMap(data)
+	defer clear(plaintext)
+	return encryptCert(plaintext, kek)
+}
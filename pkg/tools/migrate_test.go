@@ -0,0 +1,133 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestMigrateCredentialFile(t *testing.T) {
+	_, certFile := setTestFiles(t)
+	if err := MigrateCredentialFile(); err != nil {
+		t.Fatalf("expected missing file to be skipped, got %v", err)
+	}
+	if err := os.WriteFile(certFile, []byte("AK=ak\nSK=sk\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(certFile, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateCredentialFile(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected 0600 after migration, got %o", info.Mode().Perm())
+	}
+	data, err := readMapFromFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[AccessKeyName] != "ak" || data[SecretKeyName] != "sk" {
+		t.Errorf("unexpected content after migration %v", data)
+	}
+
+	// already migrated
+	if err := MigrateCredentialFile(); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.Stat(certFile); !os.SameFile(info, after) || !after.ModTime().Equal(info.ModTime()) {
+		t.Errorf("expected secure file to be left untouched")
+	}
+}
+
+func TestMigrateCredentialFileEncrypted(t *testing.T) {
+	_, certFile := setTestFiles(t)
+	kek := make([]byte, 32)
+	if err := MigrateCredentialFileEncrypted(kek[:16]); !errors.Is(err, ErrInvalidKEK) {
+		t.Errorf("expected ErrInvalidKEK, got %v", err)
+	}
+	if err := os.WriteFile(certFile, []byte("AK=ak\nSK=sk\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateCredentialFileEncrypted(kek); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(content, []byte(encryptedCertMagic)) || bytes.Contains(content, []byte("SK=sk")) {
+		t.Errorf("expected the cert file to be encrypted, got %q", content)
+	}
+	setTestKeys(t, "", "")
+	if err := LoadSecretKeyEncrypted(kek); err != nil {
+		t.Fatal(err)
+	}
+	if GetAccessKey() != "ak" || GetSecureKey() != "sk" {
+		t.Errorf("unexpected keys after migration %s/%s", GetAccessKey(), GetSecureKey())
+	}
+
+	// already migrated
+	info, _ := os.Stat(certFile)
+	if err := MigrateCredentialFileEncrypted(kek); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.Stat(certFile); !os.SameFile(info, after) {
+		t.Errorf("expected encrypted file to be left untouched")
+	}
+}
+
+func TestMigrateCredentialFileConcurrentWrites(t *testing.T) {
+	_, certFile := setTestFiles(t)
+	setTestKeys(t, "ak", "sk")
+	if err := os.WriteFile(certFile, []byte("AK=ak\nSK=sk\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(certFile, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := MigrateCredentialFile(); err != nil {
+			t.Error(err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := RecordSecretKeyToFile("ak2", "sk2"); err != nil {
+			t.Error(err)
+		}
+	}()
+	wg.Wait()
+	data, err := readMapFromFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[AccessKeyName] != "ak2" || data[SecretKeyName] != "sk2" {
+		t.Errorf("expected the concurrent write to be kept, got %v", data)
+	}
+}
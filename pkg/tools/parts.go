@@ -0,0 +1,117 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrMissingField = errors.New("missing signed field")
+
+// The scheme tags prefix the signing strings of the schemes built on Sign, so that a signature of a scheme
+// isn't accepted by another one over the same parts. Plain Sign isn't tagged, see Sign.
+const (
+	partsScheme     = "parts"
+	prehashedScheme = "prehashed"
+	aadScheme       = "aad"
+	multipartScheme = "multipart"
+)
+
+// AuthParts verifies a signature produced by SignParts
+func AuthParts(sign string, parts ...string) bool {
+	return Auth(sign, schemeSigningString(partsScheme, parts))
+}
+
+// BodyHash returns the lowercase hex sha256 of a body, the hash expected by SignPrehashed
+func BodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuthPrehashed verifies a signature produced by SignPrehashed
+func AuthPrehashed(sign, prehashHex string, extra ...string) bool {
+	return Auth(sign, prehashedSigningString(prehashHex, extra))
+}
+
+func prehashedSigningString(prehashHex string, extra []string) string {
+	parts := make([]string, 0, len(extra)+1)
+	parts = append(parts, extra...)
+	return schemeSigningString(prehashedScheme, append(parts, strings.ToLower(prehashHex)))
+}
+
+// AuthWithAAD verifies a signature produced by SignWithAAD with the same AAD
+func AuthWithAAD(sign, signData string, aad map[string]string) bool {
+	return Auth(sign, aadSigningString(signData, aad))
+}
+
+// aadSigningString signs the number of AAD entries, each key and value, then signData as parts
+func aadSigningString(signData string, aad map[string]string) string {
+	keys := make([]string, 0, len(aad))
+	for key := range aad {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, 2*len(aad)+2)
+	parts = append(parts, strconv.Itoa(len(aad)))
+	for _, key := range keys {
+		parts = append(parts, key, aad[key])
+	}
+	return schemeSigningString(aadScheme, append(parts, signData))
+}
+
+// partsSigningString returns the scheme tag and a line break followed by the encoded parts
+func schemeSigningString(scheme string, parts []string) string {
+	return scheme + "\n" + partsSigningString(parts)
+}
+
+// encodeParts concatenates the parts each prefixed with its length and a colon
+func partsSigningString(parts []string) string {
+	builder := strings.Builder{}
+	for _, part := range parts {
+		builder.WriteString(strconv.Itoa(len(part)))
+		builder.WriteString(":")
+		builder.WriteString(part)
+	}
+	return builder.String()
+}
+
+// AuthMultipart verifies a signature produced by SignMultipart over the same ordered names
+func AuthMultipart(sign string, fields map[string]string, orderedNames []string) (bool, error) {
+	signingString, err := multipartSigningString(fields, orderedNames)
+	if err != nil {
+		return false, err
+	}
+	return Auth(sign, signingString), nil
+}
+
+func multipartSigningString(fields map[string]string, orderedNames []string) (string, error) {
+	parts := make([]string, 0, 2*len(orderedNames))
+	for _, name := range orderedNames {
+		value, ok := fields[name]
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrMissingField, name)
+		}
+		parts = append(parts, name, value)
+	}
+	return schemeSigningString(multipartScheme, parts), nil
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSignParts(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	captureLog(t)
+	if Sign("a"+"bc") != Sign("ab"+"c") {
+		t.Fatalf("expected concatenated parts to collide")
+	}
+
+	sign := SignParts("a", "bc")
+	if !AuthParts(sign, "a", "bc") {
+		t.Errorf("expected signature to verify with the same parts")
+	}
+	if AuthParts(sign, "ab", "c") {
+		t.Errorf("expected signature not to verify with another split")
+	}
+	if AuthParts(sign, "abc") {
+		t.Errorf("expected signature not to verify with a single part")
+	}
+}
+
+func TestSignMultipart(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	captureLog(t)
+	fields := map[string]string{"Content-Type": "application/zip", "name": "bundle", "checksum": "abc"}
+	names := []string{"Content-Type", "name", "checksum"}
+	sign, err := SignMultipart(fields, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reordered := map[string]string{"checksum": "abc", "name": "bundle", "Content-Type": "application/zip", "volatile": "x"}
+	if ok, err := AuthMultipart(sign, reordered, names); err != nil || !ok {
+		t.Errorf("expected the map order and unsigned fields not to matter, got %v, %v", ok, err)
+	}
+	if ok, err := AuthMultipart(sign, fields, []string{"name", "Content-Type", "checksum"}); err != nil || ok {
+		t.Errorf("expected a different name order to be rejected, got %v, %v", ok, err)
+	}
+	if ok, err := AuthMultipart(sign, map[string]string{"Content-Type": "application/zip", "name": "bundle", "checksum": ""}, names); err != nil || ok {
+		t.Errorf("expected a changed value to be rejected, got %v, %v", ok, err)
+	}
+}
+
+func TestSignMultipartMissingField(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	fields := map[string]string{"name": "bundle"}
+	if _, err := SignMultipart(fields, []string{"name", "checksum"}); !errors.Is(err, ErrMissingField) {
+		t.Errorf("expected ErrMissingField, got %v", err)
+	}
+	if _, err := AuthMultipart("sign", fields, []string{"checksum"}); !errors.Is(err, ErrMissingField) {
+		t.Errorf("expected ErrMissingField, got %v", err)
+	}
+}
+
+func TestSignPrehashed(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	captureLog(t)
+	body := []byte(strings.Repeat("upload", 1024))
+	hash := BodyHash(body)
+
+	sign := SignPrehashed(hash, "PUT", "/bundles/1")
+	if AuthParts(sign, "PUT", "/bundles/1", hash) {
+		t.Errorf("expected a SignPrehashed signature not to verify as SignParts over the body hash")
+	}
+	if !AuthPrehashed(sign, strings.ToUpper(hash), "PUT", "/bundles/1") {
+		t.Errorf("expected the hash to be compared case-insensitively")
+	}
+	if AuthPrehashed(sign, BodyHash([]byte("other")), "PUT", "/bundles/1") {
+		t.Errorf("expected another body hash to be rejected")
+	}
+	if AuthPrehashed(sign, hash, "PUT", "/bundles/2") {
+		t.Errorf("expected other extra parts to be rejected")
+	}
+}
+
+func TestSignWithAAD(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	captureLog(t)
+	aad := map[string]string{"tenant": "X", "env": "prod"}
+	sign := SignWithAAD("data", aad)
+
+	if !AuthWithAAD(sign, "data", map[string]string{"env": "prod", "tenant": "X"}) {
+		t.Errorf("expected the same AAD to verify")
+	}
+	for _, other := range []map[string]string{
+		{"tenant": "Y", "env": "prod"},
+		{"tenant": "X", "env": "staging"},
+		{"tenant": "X"},
+		{"tenant": "X", "env": "prod", "region": "eu"},
+		nil,
+	} {
+		if AuthWithAAD(sign, "data", other) {
+			t.Errorf("expected AAD %v to be rejected", other)
+		}
+	}
+	if Auth(sign, "data") || AuthWithAAD(Sign("data"), "data", nil) {
+		t.Errorf("expected signatures with and without AAD not to be interchangeable")
+	}
+}
+
+func TestSchemesDontCrossVerify(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	captureLog(t)
+	if AuthParts(SignWithAAD("data", map[string]string{"env": "prod"}), "1", "env", "prod", "data") {
+		t.Errorf("expected a SignWithAAD signature not to verify as SignParts")
+	}
+	multipart, err := SignMultipart(map[string]string{"name": "value"}, []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if AuthParts(multipart, "name", "value") {
+		t.Errorf("expected a SignMultipart signature not to verify as SignParts")
+	}
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PrivateKeyName is the key of the PEM private key in the cert file. A key=value line can't hold the
+// lines of a PEM block, so the value is the standard base64 of the whole PEM.
+const PrivateKeyName = "PRIV"
+
+var (
+	ErrNoPrivateKey      = errors.New("no private key in the cert file")
+	ErrInvalidPrivateKey = errors.New("invalid PEM private key")
+)
+
+// RecordPrivateKeyPEM records a PEM private key into the cert file next to the AK/SK, which are kept.
+// ErrNotTextCertFile is returned for a cert file in another format than the text one.
+func RecordPrivateKeyPEM(pemData []byte) error {
+	block, _ := pem.Decode(pemData)
+	if block == nil || !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+		return ErrInvalidPrivateKey
+	}
+	if skip, err := skipPersistence(); skip {
+		return err
+	}
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return err
+	}
+	if format := persistFormat(certFile, certFormatText); format != certFormatText {
+		return fmt.Errorf("%w: %s is a %s cert file", ErrNotTextCertFile, certFile, format)
+	}
+	keys, err := readMapFromFile(certFile)
+	if err != nil {
+		return err
+	}
+	keys[PrivateKeyName] = base64.StdEncoding.EncodeToString(pemData)
+	if err := writeCredentialFile(keys, certFile); err != nil {
+		return err
+	}
+	recordCertFileState(certFile)
+	return nil
+}
+
+// ReadPrivateKeyPEM returns the PEM private key recorded by RecordPrivateKeyPEM
+func ReadPrivateKeyPEM() ([]byte, error) {
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return nil, err
+	}
+	data, err := readMapFromFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := data[PrivateKeyName]
+	if !ok {
+		return nil, ErrNoPrivateKey
+	}
+	pemData, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPrivateKey, err)
+	}
+	if block, _ := pem.Decode(pemData); block == nil {
+		return nil, ErrInvalidPrivateKey
+	}
+	return pemData, nil
+}
+
+// keepPrivateKey adds the private key of the cert file to keys about to replace it, the caller holds the mutex
+func keepPrivateKey(keys map[string]string, certFile string) map[string]string {
+	if _, ok := keys[PrivateKeyName]; ok {
+		return keys
+	}
+	previous, err := readMapFromFile(certFile)
+	if err != nil {
+		return keys
+	}
+	if value, ok := previous[PrivateKeyName]; ok {
+		keys[PrivateKeyName] = value
+	}
+	return keys
+}
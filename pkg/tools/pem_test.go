@@ -0,0 +1,77 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPrivateKeyPEMRoundTrip(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadPrivateKeyPEM(); !errors.Is(err, ErrNoPrivateKey) {
+		t.Errorf("expected ErrNoPrivateKey, got %v", err)
+	}
+	if err := RecordPrivateKeyPEM(pemData); err != nil {
+		t.Fatal(err)
+	}
+	if read, err := ReadPrivateKeyPEM(); err != nil || !bytes.Equal(read, pemData) {
+		t.Fatalf("expected the PEM to round-trip, got %q, %v", read, err)
+	}
+
+	// the single-line values still parse and rewriting them keeps the private key
+	setTestKeys(t, "", "")
+	if err := LoadSecretKeyFromFile(); err != nil || GetSecureKey() != "sk" {
+		t.Fatalf("expected the keys to load next to the private key, got %v", err)
+	}
+	if err := RecordCredentialExpiry(time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if read, err := ReadPrivateKeyPEM(); err != nil || !bytes.Equal(read, pemData) {
+		t.Errorf("expected the private key to be kept, got %v", err)
+	}
+}
+
+func TestRecordPrivateKeyPEMInvalid(t *testing.T) {
+	setTestFiles(t)
+	if err := RecordPrivateKeyPEM([]byte("not a pem")); !errors.Is(err, ErrInvalidPrivateKey) {
+		t.Errorf("expected ErrInvalidPrivateKey, got %v", err)
+	}
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("der")})
+	if err := RecordPrivateKeyPEM(certificate); !errors.Is(err, ErrInvalidPrivateKey) {
+		t.Errorf("expected a certificate to be rejected, got %v", err)
+	}
+}
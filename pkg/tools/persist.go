@@ -0,0 +1,126 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PersistPeriodically rewrites the in-memory AK/SK to the cert file every interval, plus up to 10%
+// jitter, when the file is missing or differs, so that a wiped cert file heals itself. It stops when
+// ctx is done. A non-positive interval is logged and ignored.
+func PersistPeriodically(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		log.Warnf("persist interval must be positive, got %s, the cert file won't be persisted periodically", interval)
+		return
+	}
+	ctx, done := startBackground(ctx)
+	go func() {
+		defer done()
+		defer PanicPrintStack()
+		for {
+			timer := time.NewTimer(interval + time.Duration(rand.Int63n(int64(interval)/10+1)))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if err := persistSecretKey(); err != nil {
+				log.WithError(err).Warningln("persist secret key to file failed")
+			}
+		}
+	}()
+}
+
+// persistSecretKey writes the in-memory AK/SK back to the cert file they were loaded from unless it
+// already holds them, in the format they were loaded from: an encrypted file can't be without the KEK
+// and a keyring-backed one must not get the SK, so they're left alone. Keys of another source, like the
+// environment or a FIFO, are never written.
+func persistSecretKey() error {
+	creds, source := defaultManager.loadedFrom()
+	if skip, _ := skipPersistence(); creds.AccessKey == "" || creds.SecretKey == "" || skip {
+		return nil
+	}
+	if source.kind != sourceCertFile {
+		log.Debugf("skip persisting the keys of the %s", source)
+		return nil
+	}
+	certFile := source.certFile
+	switch format := persistFormat(certFile, source.format); format {
+	case certFormatText:
+		return persistTextSecretKey(certFile, creds)
+	case certFormatBinary:
+		return persistBinarySecretKey(certFile, creds)
+	default:
+		log.WithField("file", certFile).Debugf("skip persisting the %s cert file", format)
+		return nil
+	}
+}
+
+// persistFormat returns the format of certFile read from its content, falling back to the format the keys
+// were loaded in for a missing file, so that a file replaced in another format isn't overwritten with the
+// keys in clear
+func persistFormat(certFile string, loaded certFileFormat) certFileFormat {
+	content, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return loaded
+	}
+	switch {
+	case bytes.HasPrefix(content, []byte(binaryCertMagic)):
+		return certFormatBinary
+	case bytes.HasPrefix(content, []byte(encryptedCertMagic)):
+		return certFormatEncrypted
+	}
+	data, err := readMapFromFile(certFile)
+	if err == nil && data[AccessKeyName] != "" && data[SecretKeyName] == "" {
+		return certFormatKeyring
+	}
+	return loaded
+}
+
+func persistTextSecretKey(certFile string, creds Credentials) error {
+	data, err := readMapFromFile(certFile)
+	recorded := Credentials{AccessKey: data[AccessKeyName], SecretKey: data[SecretKeyName]}
+	if err == nil && CredentialsEqual(recorded, creds) {
+		return nil
+	}
+	return writeCredentialFile(certFileKeys(creds), certFile)
+}
+
+func persistBinarySecretKey(certFile string, creds Credentials) error {
+	if content, err := ioutil.ReadFile(certFile); err == nil {
+		accessKey, secretKey, err := decodeBinaryCert(content)
+		if err == nil && CredentialsEqual(Credentials{AccessKey: accessKey, SecretKey: secretKey}, creds) {
+			return nil
+		}
+	}
+	content, err := encodeBinaryCert(creds.AccessKey, creds.SecretKey)
+	if err != nil {
+		return err
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	authCounters.fileWrites.Add(1)
+	return writePrivateFile(certFile, content)
+}
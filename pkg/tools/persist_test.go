@@ -0,0 +1,171 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPersistPeriodically(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := persistSecretKey(); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.Stat(certFile); !after.ModTime().Equal(stat.ModTime()) {
+		t.Errorf("expected matching file not to be rewritten")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	PersistPeriodically(ctx, 10*time.Millisecond)
+	if err := os.Remove(certFile); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !IsExist(certFile) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected cert file to be re-created")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	data, err := readMapFromFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[AccessKeyName] != "ak" || data[SecretKeyName] != "sk" {
+		t.Errorf("unexpected cert file content %v", data)
+	}
+}
+
+func TestPersistPeriodicallyInvalidInterval(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	_, certFile := setTestFiles(t)
+	buffer := captureLog(t)
+	for _, interval := range []time.Duration{0, -time.Nanosecond, -time.Second} {
+		PersistPeriodically(context.Background(), interval)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if IsExist(certFile) {
+		t.Errorf("expected no persistence with a non-positive interval")
+	}
+	if !strings.Contains(buffer.String(), "persist interval must be positive") {
+		t.Errorf("expected the interval to be reported, got %q", buffer.String())
+	}
+}
+
+func TestPersistKeepsEncryptedCertFile(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	kek := bytes.Repeat([]byte{1}, 32)
+	if err := RecordSecretKeyEncrypted("ak", "plain-secret", kek); err != nil {
+		t.Fatal(err)
+	}
+	if err := persistSecretKey(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(certFile); bytes.Contains(content, []byte("plain-secret")) {
+		t.Fatalf("expected the SK not to be persisted in clear, got %q", content)
+	}
+	setCredentials("", "")
+	if err := LoadSecretKeyEncrypted(kek); err != nil || GetSecureKey() != "plain-secret" {
+		t.Errorf("expected the encrypted cert file to still load, got %v", err)
+	}
+
+	// a wiped encrypted file can't be written again without the KEK
+	if err := os.Remove(certFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := persistSecretKey(); err != nil || IsExist(certFile) {
+		t.Errorf("expected a wiped encrypted cert file not to be written in clear, got %v", err)
+	}
+}
+
+func TestPersistBinaryCertFile(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	if err := RecordSecretKeyBinary("ak", "binary-secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	setCredentials("", "")
+	if err := LoadSecretKeyBinary(); err != nil || GetSecureKey() != "binary-secret" {
+		t.Fatalf("expected the binary cert file to be kept by Shutdown, got %v", err)
+	}
+	if err := os.Remove(certFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := persistSecretKey(); err != nil {
+		t.Fatal(err)
+	}
+	setCredentials("", "")
+	if err := LoadSecretKeyBinary(); err != nil || GetSecureKey() != "binary-secret" {
+		t.Errorf("expected the binary cert file to be persisted again in binary, got %v", err)
+	}
+	if info, err := os.Stat(certFile); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected the binary cert file to be readable by the owner only, got %v, %v", info, err)
+	}
+}
+
+func TestPersistOnlyCertFileKeys(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	t.Setenv(AccessKeyEnv, "ak-env")
+	t.Setenv(SecretKeyEnv, "sk-env-very-secret")
+	profilesFile := writeTestProfiles(t, map[string]Credentials{"default": {AccessKey: "ak-profile", SecretKey: "sk-profile"}})
+	sources := map[string]func() error{
+		"env":     LoadSecretKeyFromEnv,
+		"reader":  func() error { return LoadSecretKeyFromReader(strings.NewReader("AK=ak-fifo\nSK=sk-fifo\n")) },
+		"profile": func() error { return UseProfile(profilesFile, "default") },
+		"memory":  func() error { return DefaultManager().Set("ak-memory", "sk-memory") },
+		"store":   func() error { return InitCredentials(EnvStore{}) },
+	}
+	for name, load := range sources {
+		t.Run(name, func(t *testing.T) {
+			if err := load(); err != nil {
+				t.Fatal(err)
+			}
+			if err := Shutdown(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if err := persistSecretKey(); err != nil {
+				t.Fatal(err)
+			}
+			if content, err := os.ReadFile(certFile); !os.IsNotExist(err) {
+				t.Errorf("expected the keys of the %s not to be persisted, got %q", name, content)
+			}
+		})
+	}
+}
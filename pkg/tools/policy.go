@@ -0,0 +1,85 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"fmt"
+)
+
+// KeyPolicy restricts the operations allowed with the in-memory keys, as marked by the server
+type KeyPolicy string
+
+const (
+	// PolicyKeyName is the key of the key policy in the cert file, no policy is PolicySignAndVerify
+	PolicyKeyName = "policy"
+
+	PolicySignAndVerify KeyPolicy = "sign-and-verify"
+	// PolicyVerifyOnly is for agents that must never originate signed requests
+	PolicyVerifyOnly KeyPolicy = "verify-only"
+)
+
+var (
+	ErrOperationNotPermitted = errors.New("operation not permitted by the key policy")
+	ErrUnknownKeyPolicy      = errors.New("unknown key policy")
+)
+
+func parseKeyPolicy(value string) (KeyPolicy, error) {
+	switch policy := KeyPolicy(value); policy {
+	case "", PolicySignAndVerify:
+		return PolicySignAndVerify, nil
+	case PolicyVerifyOnly:
+		return policy, nil
+	default:
+		return PolicyVerifyOnly, fmt.Errorf("%w: %s", ErrUnknownKeyPolicy, value)
+	}
+}
+
+// SetPolicy restricts the operations allowed with the keys until they change
+func (m *CredentialManager) SetPolicy(policy KeyPolicy) {
+	m.policy.Store(policy)
+}
+
+// Policy returns the policy of the keys, PolicySignAndVerify unless restricted
+func (m *CredentialManager) Policy() KeyPolicy {
+	if policy, ok := m.policy.Load().(KeyPolicy); ok {
+		return policy
+	}
+	return PolicySignAndVerify
+}
+
+// CurrentKeyPolicy returns the policy of the in-memory keys. It's loaded from the cert file with the keys
+// and reset when the keys are set otherwise.
+func CurrentKeyPolicy() KeyPolicy {
+	return defaultManager.Policy()
+}
+
+// checkSignPermitted returns ErrOperationNotPermitted if the keys are verify-only
+func checkSignPermitted() error {
+	if policy := defaultManager.Policy(); policy == PolicyVerifyOnly {
+		return fmt.Errorf("%w: sign with %s keys", ErrOperationNotPermitted, policy)
+	}
+	return nil
+}
+
+// withKeyPolicy adds the policy of the in-memory keys to the keys written to the cert file
+func withKeyPolicy(keys map[string]string) map[string]string {
+	if policy := defaultManager.Policy(); policy != PolicySignAndVerify {
+		keys[PolicyKeyName] = string(policy)
+	}
+	return keys
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestVerifyOnlyPolicy(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	if err := os.WriteFile(certFile, []byte("AK=ak\nSK=sk\npolicy=verify-only\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadSecretKeyFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	if CurrentKeyPolicy() != PolicyVerifyOnly {
+		t.Fatalf("expected the policy to be loaded, got %s", CurrentKeyPolicy())
+	}
+	captureLog(t)
+	if _, err := SignErr("data"); !errors.Is(err, ErrOperationNotPermitted) {
+		t.Errorf("expected ErrOperationNotPermitted, got %v", err)
+	}
+	if Sign("data") != "" {
+		t.Errorf("expected Sign to refuse verify-only keys")
+	}
+	if !Auth(signWithKey("data", "sk", HexBase64Codec{}), "data") {
+		t.Errorf("expected Auth to succeed with verify-only keys")
+	}
+
+	// the policy is kept when the file is rewritten
+	if err := RecordCredentialExpiry(timeNow().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := readMapFromFile(certFile); err != nil || data[PolicyKeyName] != string(PolicyVerifyOnly) {
+		t.Errorf("expected the policy to be kept in the cert file, got %v, %v", data, err)
+	}
+
+	setCredentials("other-ak", "other-sk")
+	if _, err := SignErr("data"); err != nil {
+		t.Errorf("expected the policy to be reset with other keys, got %v", err)
+	}
+}
+
+func TestUnknownPolicyIsVerifyOnly(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	if err := os.WriteFile(certFile, []byte("AK=ak\nSK=sk\npolicy=sign-only\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	captureLog(t)
+	if err := LoadSecretKeyFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignErr("data"); !errors.Is(err, ErrOperationNotPermitted) {
+		t.Errorf("expected an unknown policy to restrict signing, got %v", err)
+	}
+}
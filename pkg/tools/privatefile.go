@@ -0,0 +1,57 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"os"
+)
+
+// openFile opens filePath for writing, creating it with perm. A private perm, with no bit for the group
+// and others, is applied to an existing file before it's truncated, so that the new content is never
+// readable with looser permissions. The process umask is left alone, it's shared by all goroutines.
+func openFile(filePath string, truncate bool, perm os.FileMode) (*os.File, error) {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, perm)
+	if err != nil {
+		return nil, err
+	}
+	if perm&0o077 == 0 {
+		if err := file.Chmod(perm); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if truncate {
+		if err := file.Truncate(0); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
+// writePrivateFile replaces the content of filePath, which is readable by the owner only
+func writePrivateFile(filePath string, content []byte) error {
+	file, err := openFile(filePath, true, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+//go:build !windows
+
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCredentialFilePermissions(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	old := syscall.Umask(0o022)
+	defer syscall.Umask(old)
+
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected 0600, got %o", info.Mode().Perm())
+	}
+	if umask := syscall.Umask(0o022); umask != 0o022 {
+		t.Errorf("expected the umask to be left alone, got %o", umask)
+	}
+
+	if err := os.Chmod(certFile, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordSecretKeyToFile("ak", "sk2"); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(certFile); info.Mode().Perm() != 0o600 {
+		t.Errorf("expected loose permissions to be fixed, got %o", info.Mode().Perm())
+	}
+}
+
+func TestWritePrivateFileRestrictsExistingFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "cert")
+	if err := os.WriteFile(filePath, []byte("old content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filePath, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePrivateFile(filePath, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected 0600, got %o", info.Mode().Perm())
+	}
+	if content, _ := os.ReadFile(filePath); string(content) != "new" {
+		t.Errorf("expected the content to be replaced, got %q", content)
+	}
+}
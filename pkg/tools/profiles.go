@@ -0,0 +1,164 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrMalformedProfile = errors.New("malformed profile")
+	ErrDuplicateProfile = errors.New("duplicate profile")
+	ErrUnknownProfile   = errors.New("unknown profile")
+)
+
+var (
+	// profileMutex serializes the profile switches, currentProfile is guarded by it
+	profileMutex   sync.Mutex
+	currentProfile string
+)
+
+// LoadProfilesFromReader parses the credentials of many profiles written by WriteProfiles. Each profile
+// is a [name] section followed by AK=... and SK=... lines, blank lines and lines starting with # are ignored.
+func LoadProfilesFromReader(r io.Reader) (map[string]Credentials, error) {
+	profiles := make(map[string]Credentials)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), MaxLineLength)
+	name, lineNumber := "", 0
+	var current map[string]string
+	finish := func() error {
+		if current == nil {
+			return nil
+		}
+		creds := Credentials{AccessKey: current[AccessKeyName], SecretKey: current[SecretKeyName]}
+		if creds.AccessKey == "" || creds.SecretKey == "" {
+			return fmt.Errorf("%w: accessKey or secretKey is empty in profile %s", ErrMalformedProfile, name)
+		}
+		profiles[name] = creds
+		return nil
+	}
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || len(line) == 2 {
+				return nil, fmt.Errorf("%w: invalid section at line %d", ErrMalformedProfile, lineNumber)
+			}
+			if err := finish(); err != nil {
+				return nil, err
+			}
+			name = strings.TrimSpace(line[1 : len(line)-1])
+			if _, ok := profiles[name]; ok {
+				return nil, fmt.Errorf("%w: %s at line %d", ErrDuplicateProfile, name, lineNumber)
+			}
+			current = make(map[string]string)
+			continue
+		}
+		kv := strings.SplitN(line, Delimiter, 2)
+		if current == nil || len(kv) != 2 {
+			return nil, fmt.Errorf("%w: unexpected line %d outside of key=value in a section", ErrMalformedProfile, lineNumber)
+		}
+		current[kv[0]] = kv[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// WriteProfiles writes the credentials of many profiles in the format read by LoadProfilesFromReader,
+// sorted by profile name
+func WriteProfiles(w io.Writer, profiles map[string]Credentials) error {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		if name == "" || strings.ContainsAny(name, "[]\r\n") {
+			return fmt.Errorf("%w: invalid profile name %q", ErrMalformedProfile, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	builder := strings.Builder{}
+	for i, name := range names {
+		creds := profiles[name]
+		if creds.AccessKey == "" || creds.SecretKey == "" {
+			return fmt.Errorf("%w: accessKey or secretKey is empty in profile %s", ErrMalformedProfile, name)
+		}
+		if i > 0 {
+			builder.WriteString("\n")
+		}
+		builder.WriteString("[" + name + "]\n")
+		builder.Write(encodeMap(map[string]string{
+			AccessKeyName: creds.AccessKey,
+			SecretKeyName: creds.SecretKey,
+		}))
+	}
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// UseProfile switches the in-memory keys to the named profile of the profiles file. Switches are
+// serialized and the profile's credentials are fully read before being swapped in at once, so that
+// a concurrent Sign uses the keys of one profile and never a mix. The keys aren't persisted.
+func UseProfile(profilesFile, name string) error {
+	profileMutex.Lock()
+	defer profileMutex.Unlock()
+	file, err := os.Open(profilesFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	profiles, err := LoadProfilesFromReader(file)
+	if err != nil {
+		return err
+	}
+	creds, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("%w: %s in %s", ErrUnknownProfile, name, profilesFile)
+	}
+	if err := checkSecretStrength(creds.SecretKey); err != nil {
+		return fmt.Errorf("profile %s: %w", name, err)
+	}
+	defaultManager.forgetCertFile()
+	source := credentialSource{kind: sourceProfile, reload: func() error {
+		return UseProfile(profilesFile, name)
+	}}
+	if err := defaultManager.setFrom(source, creds.AccessKey, creds.SecretKey); err != nil {
+		return err
+	}
+	currentProfile = name
+	return nil
+}
+
+// CurrentProfile returns the name of the profile last switched to by UseProfile, empty if none
+func CurrentProfile() string {
+	profileMutex.Lock()
+	defer profileMutex.Unlock()
+	return currentProfile
+}
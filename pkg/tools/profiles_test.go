@@ -0,0 +1,168 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestProfilesRoundTrip(t *testing.T) {
+	profiles := map[string]Credentials{
+		"prod":    {AccessKey: "ak1", SecretKey: "sk1"},
+		"staging": {AccessKey: "ak2", SecretKey: "sk=2"},
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteProfiles(buf, profiles); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadProfilesFromReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, profiles) {
+		t.Errorf("expected %v, got %v", profiles, loaded)
+	}
+}
+
+func TestLoadProfilesFromReaderErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected error
+	}{
+		{"duplicate", "[a]\nAK=ak\nSK=sk\n[a]\nAK=ak\nSK=sk\n", ErrDuplicateProfile},
+		{"outside section", "AK=ak\n[a]\nAK=ak\nSK=sk\n", ErrMalformedProfile},
+		{"unterminated section", "[a\nAK=ak\nSK=sk\n", ErrMalformedProfile},
+		{"empty section name", "[]\nAK=ak\nSK=sk\n", ErrMalformedProfile},
+		{"missing secret key", "[a]\nAK=ak\n[b]\nAK=ak\nSK=sk\n", ErrMalformedProfile},
+		{"not key value", "[a]\nAK=ak\nSK=sk\ngarbage\n", ErrMalformedProfile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadProfilesFromReader(strings.NewReader(tt.content)); !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestLoadProfilesFromReaderIgnoresComments(t *testing.T) {
+	profiles, err := LoadProfilesFromReader(strings.NewReader("# fleet\n\n[a]\nAK=ak\r\nSK=sk\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profiles["a"] != (Credentials{AccessKey: "ak", SecretKey: "sk"}) {
+		t.Errorf("unexpected profiles %v", profiles)
+	}
+}
+
+func writeTestProfiles(t *testing.T, profiles map[string]Credentials) string {
+	t.Helper()
+	buffer := bytes.Buffer{}
+	if err := WriteProfiles(&buffer, profiles); err != nil {
+		t.Fatal(err)
+	}
+	profilesFile := filepath.Join(t.TempDir(), "profiles")
+	if err := os.WriteFile(profilesFile, buffer.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return profilesFile
+}
+
+func TestUseProfile(t *testing.T) {
+	setTestKeys(t, "", "")
+	t.Cleanup(func() { currentProfile = "" })
+	profilesFile := writeTestProfiles(t, map[string]Credentials{
+		"prod": {AccessKey: "prod-ak", SecretKey: "prod-sk"},
+	})
+	if err := UseProfile(profilesFile, "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if CurrentProfile() != "prod" || GetAccessKey() != "prod-ak" || GetSecureKey() != "prod-sk" {
+		t.Errorf("expected the prod profile to be in use")
+	}
+	if err := UseProfile(profilesFile, "staging"); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("expected ErrUnknownProfile, got %v", err)
+	}
+	if CurrentProfile() != "prod" || GetSecureKey() != "prod-sk" {
+		t.Errorf("expected a failed switch to keep the current profile")
+	}
+}
+
+func TestUseProfileConcurrentSign(t *testing.T) {
+	setTestKeys(t, "", "")
+	t.Cleanup(func() { currentProfile = "" })
+	profiles := map[string]Credentials{
+		"a": {AccessKey: "ak-a", SecretKey: "sk-a"},
+		"b": {AccessKey: "ak-b", SecretKey: "sk-b"},
+	}
+	profilesFile := writeTestProfiles(t, profiles)
+	const signData = "data"
+	expected := make(map[string]string)
+	for _, creds := range profiles {
+		expected[signWithKey(signData, creds.SecretKey, HexBase64Codec{})] = KeyFingerprint(creds.SecretKey)
+	}
+	if err := UseProfile(profilesFile, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for _, name := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if err := UseProfile(profilesFile, name); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(name)
+	}
+	signers := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		signers.Add(1)
+		go func() {
+			defer signers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, ok := expected[Sign(signData)]; !ok {
+					t.Error("expected the signature to correspond to exactly one profile's key")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	signers.Wait()
+	if name := CurrentProfile(); name != "a" && name != "b" {
+		t.Errorf("unexpected current profile %q", name)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CredentialProvider retrieves credentials with their expiry, zero if they don't expire. The cert file
+// is one provider, a provider of short-lived credentials like STS another.
+type CredentialProvider interface {
+	Retrieve(ctx context.Context) (Credentials, time.Time, error)
+}
+
+// FileCredentialProvider retrieves the credentials from the cert file
+type FileCredentialProvider struct{}
+
+func (FileCredentialProvider) Retrieve(ctx context.Context) (Credentials, time.Time, error) {
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return Credentials{}, time.Time{}, err
+	}
+	data, err := readMapFromFile(certFile)
+	if err != nil {
+		return Credentials{}, time.Time{}, err
+	}
+	creds := Credentials{AccessKey: data[AccessKeyName], SecretKey: data[SecretKeyName]}
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return Credentials{}, time.Time{}, errors.New("accessKey or secretKey is empty in " + certFile)
+	}
+	expiry, err := parseExpiry(data[ExpiryKeyName])
+	return creds, expiry, err
+}
+
+// refreshRetryInterval is the delay before retrying a failed refresh
+var refreshRetryInterval = 10 * time.Second
+
+// RefreshCredentials retrieves the credentials from provider, then keeps refreshing them in the
+// background ahead of their expiry, swapping the in-memory keys atomically. A failed refresh is
+// retried until the credentials expire and beyond. Credentials without expiry aren't refreshed.
+// It stops when ctx is done.
+func RefreshCredentials(ctx context.Context, provider CredentialProvider, ahead time.Duration) error {
+	expiry, err := refreshCredentials(ctx, provider)
+	if err != nil {
+		return err
+	}
+	retryInterval := refreshRetryInterval
+	ctx, done := startBackground(ctx)
+	go func() {
+		defer done()
+		defer PanicPrintStack()
+		wait := refreshDelay(expiry, time.Time{}, ahead, retryInterval)
+		for !expiry.IsZero() {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			next, err := refreshCredentials(ctx, provider)
+			if err != nil {
+				log.WithError(err).WithField("expiry", expiry).Warningln("refresh credentials failed")
+				wait = retryInterval
+				continue
+			}
+			wait = refreshDelay(next, expiry, ahead, retryInterval)
+			expiry = next
+		}
+	}()
+	return nil
+}
+
+// refreshDelay returns the delay before refreshing credentials expiring at expiry, ahead of it. Credentials
+// already due, or not extending the previous ones, are refreshed after retryInterval at the earliest, so
+// that a provider issuing short-lived credentials doesn't make the refresher spin.
+func refreshDelay(expiry, previous time.Time, ahead, retryInterval time.Duration) time.Duration {
+	wait := time.Until(expiry) - ahead
+	if wait <= 0 || (!previous.IsZero() && !expiry.After(previous)) {
+		return max(wait, retryInterval)
+	}
+	return wait
+}
+
+func refreshCredentials(ctx context.Context, provider CredentialProvider) (time.Time, error) {
+	creds, expiry, err := provider.Retrieve(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return time.Time{}, errors.New("provider returned an empty accessKey or secretKey")
+	}
+	defaultManager.forgetCertFile()
+	source := credentialSource{kind: sourceProvider, reload: func() error {
+		_, err := refreshCredentials(context.Background(), provider)
+		return err
+	}}
+	if err := defaultManager.swap(creds, &expiry, &source); err != nil {
+		return time.Time{}, err
+	}
+	return expiry, nil
+}
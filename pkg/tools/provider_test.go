@@ -0,0 +1,164 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rotatingProvider issues new credentials valid for ttl on every retrieval, failing the ones listed in fail
+type rotatingProvider struct {
+	lock  sync.Mutex
+	ttl   time.Duration
+	calls int
+	fail  map[int]bool
+}
+
+func (p *rotatingProvider) Retrieve(ctx context.Context) (Credentials, time.Time, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.calls++
+	if p.fail[p.calls] {
+		return Credentials{}, time.Time{}, errors.New("provider unavailable")
+	}
+	creds := Credentials{AccessKey: "ak", SecretKey: fmt.Sprintf("sk%d", p.calls)}
+	return creds, time.Now().Add(p.ttl), nil
+}
+
+func TestRefreshCredentials(t *testing.T) {
+	setTestKeys(t, "", "")
+	captureLog(t)
+	defer defaultManager.setExpiry(time.Time{})
+	provider := &rotatingProvider{ttl: 100 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := RefreshCredentials(ctx, provider, 80*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if GetSecureKey() != "sk1" {
+		t.Fatalf("expected the first credentials to be loaded, got %s", GetSecureKey())
+	}
+	expiry := CredentialExpiry()
+	deadline := time.Now().Add(time.Second)
+	for GetSecureKey() == "sk1" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if GetSecureKey() != "sk2" {
+		t.Fatalf("expected the credentials to be refreshed, got %s", GetSecureKey())
+	}
+	if time.Now().After(expiry) {
+		t.Errorf("expected the credentials to be refreshed before they expire")
+	}
+	if !CredentialExpiry().After(expiry) {
+		t.Errorf("expected the expiry to move forward")
+	}
+}
+
+func TestRefreshCredentialsRetries(t *testing.T) {
+	setTestKeys(t, "", "")
+	captureLog(t)
+	defer defaultManager.setExpiry(time.Time{})
+	oldInterval := refreshRetryInterval
+	refreshRetryInterval = time.Millisecond
+	defer func() {
+		refreshRetryInterval = oldInterval
+	}()
+	provider := &rotatingProvider{ttl: 50 * time.Millisecond, fail: map[int]bool{2: true}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := RefreshCredentials(ctx, provider, 40*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for GetSecureKey() == "sk1" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if GetSecureKey() != "sk3" {
+		t.Errorf("expected the failed refresh to be retried, got %s", GetSecureKey())
+	}
+}
+
+func TestRefreshCredentialsInitialFailure(t *testing.T) {
+	provider := &rotatingProvider{fail: map[int]bool{1: true}}
+	if err := RefreshCredentials(context.Background(), provider, time.Second); err == nil {
+		t.Error("expected the initial failure to be returned")
+	}
+}
+
+func TestFileCredentialProvider(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	creds, expiry, err := FileCredentialProvider{}.Retrieve(context.Background())
+	if err != nil || creds != (Credentials{AccessKey: "ak", SecretKey: "sk"}) || !expiry.IsZero() {
+		t.Errorf("unexpected %+v, %v, %v", creds, expiry, err)
+	}
+}
+
+func TestRefreshCredentialsDueExpiry(t *testing.T) {
+	setTestKeys(t, "", "")
+	captureLog(t)
+	defer defaultManager.setExpiry(time.Time{})
+	oldInterval := refreshRetryInterval
+	refreshRetryInterval = 50 * time.Millisecond
+	defer func() {
+		refreshRetryInterval = oldInterval
+	}()
+	// the credentials are already within the refresh period when issued
+	provider := &rotatingProvider{ttl: 30 * time.Second}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := RefreshCredentials(ctx, provider, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	provider.lock.Lock()
+	calls := provider.calls
+	provider.lock.Unlock()
+	if calls < 2 || calls > 6 {
+		t.Errorf("expected a refresh per retry interval, got %d retrievals", calls)
+	}
+}
+
+func TestRefreshDelay(t *testing.T) {
+	now := time.Now()
+	for _, c := range []struct {
+		expiry, previous time.Time
+		min, max         time.Duration
+	}{
+		{now.Add(time.Hour), time.Time{}, 58 * time.Minute, time.Hour},
+		{now.Add(time.Hour), now.Add(time.Minute), 58 * time.Minute, time.Hour},
+		{now.Add(30 * time.Second), time.Time{}, 10 * time.Second, 10 * time.Second},
+		{now.Add(-time.Minute), now.Add(-time.Hour), 10 * time.Second, 10 * time.Second},
+		{now.Add(time.Hour), now.Add(time.Hour), 58 * time.Minute, time.Hour},
+		{now.Add(61 * time.Second), now.Add(61 * time.Second), 10 * time.Second, 10 * time.Second},
+	} {
+		if wait := refreshDelay(c.expiry, c.previous, time.Minute, 10*time.Second); wait < c.min || wait > c.max {
+			t.Errorf("expected a delay between %s and %s for expiry %s, got %s", c.min, c.max, c.expiry.Sub(now), wait)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"sync"
+)
+
+// NonceSize is the number of random bytes of a nonce
+const NonceSize = 16
+
+var (
+	// randReader is the source of every random value generated for authentication
+	randReader     io.Reader = rand.Reader
+	randReaderLock sync.RWMutex
+)
+
+// SetRandReader replaces the randomness source, nil restores crypto/rand. It's a test hook to get
+// reproducible output, production code must never override it.
+func SetRandReader(reader io.Reader) {
+	if reader == nil {
+		reader = rand.Reader
+	}
+	randReaderLock.Lock()
+	defer randReaderLock.Unlock()
+	randReader = reader
+}
+
+// readRandom fills b from the randomness source
+func readRandom(b []byte) error {
+	randReaderLock.RLock()
+	defer randReaderLock.RUnlock()
+	_, err := io.ReadFull(randReader, b)
+	return err
+}
+
+// GenerateNonce returns a hex encoded random nonce of NonceSize bytes
+func GenerateNonce() (string, error) {
+	b := make([]byte, NonceSize)
+	if err := readRandom(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
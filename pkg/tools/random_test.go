@@ -0,0 +1,52 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerateNonceWithFixedReader(t *testing.T) {
+	SetRandReader(bytes.NewReader(bytes.Repeat([]byte{0xab}, NonceSize)))
+	defer SetRandReader(nil)
+	nonce, err := GenerateNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != strings.Repeat("ab", NonceSize) {
+		t.Errorf("unexpected nonce %s", nonce)
+	}
+	if _, err := GenerateNonce(); err == nil {
+		t.Errorf("expected error when the reader is exhausted")
+	}
+}
+
+func TestGenerateNonce(t *testing.T) {
+	first, err := GenerateNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second || len(first) != 2*NonceSize {
+		t.Errorf("unexpected nonces %s and %s", first, second)
+	}
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrPersistenceDisabled is returned by the file writes skipped by SetReadOnly when ReportReadOnlyWrites is enabled
+var ErrPersistenceDisabled = errors.New("file persistence disabled")
+
+var (
+	readOnly             atomic.Bool
+	reportReadOnlyWrites atomic.Bool
+)
+
+// SetReadOnly disables all the file writes of this package for agents running on a read-only filesystem.
+// The writes are skipped silently while the in-memory state is still updated.
+func SetReadOnly(enabled bool) {
+	readOnly.Store(enabled)
+}
+
+// ReportReadOnlyWrites makes the writes skipped by SetReadOnly return ErrPersistenceDisabled instead of nil
+func ReportReadOnlyWrites(enabled bool) {
+	reportReadOnlyWrites.Store(enabled)
+}
+
+// skipPersistence returns whether a file write must be skipped, and the error to return for it
+func skipPersistence() (bool, error) {
+	if !readOnly.Load() {
+		return false, nil
+	}
+	if reportReadOnlyWrites.Load() {
+		return true, ErrPersistenceDisabled
+	}
+	return true, nil
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func setTestReadOnly(t *testing.T, report bool) {
+	t.Helper()
+	SetReadOnly(true)
+	ReportReadOnlyWrites(report)
+	t.Cleanup(func() {
+		SetReadOnly(false)
+		ReportReadOnlyWrites(false)
+	})
+}
+
+func TestSetReadOnly(t *testing.T) {
+	setTestKeys(t, "", "")
+	appFile, certFile := setTestFiles(t)
+	setTestReadOnly(t, false)
+
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	if GetAccessKey() != "ak" || GetSecureKey() != "sk" {
+		t.Errorf("expected the in-memory keys to be updated")
+	}
+	if _, err := RecordApplicationToFile("instance", "group", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := CommitAll(Credentials{AccessKey: "ak2", SecretKey: "sk2"}, AppInfo{AppInstance: "instance"}); err != nil {
+		t.Fatal(err)
+	}
+	if GetAccessKey() != "ak2" {
+		t.Errorf("expected CommitAll to update the in-memory keys")
+	}
+	if err := persistSecretKey(); err != nil {
+		t.Fatal(err)
+	}
+	for _, filePath := range []string{appFile, certFile} {
+		if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+			t.Errorf("expected %s not to be written, got %v", filePath, err)
+		}
+	}
+}
+
+func TestReportReadOnlyWrites(t *testing.T) {
+	setTestKeys(t, "", "")
+	appFile, certFile := setTestFiles(t)
+	setTestReadOnly(t, true)
+
+	if err := RecordSecretKeyToFile("ak", "sk"); !errors.Is(err, ErrPersistenceDisabled) {
+		t.Errorf("expected ErrPersistenceDisabled, got %v", err)
+	}
+	if GetAccessKey() != "ak" {
+		t.Errorf("expected the in-memory keys to be updated")
+	}
+	if err := MergeMapToFile(map[string]string{"key": "value"}, appFile); !errors.Is(err, ErrPersistenceDisabled) {
+		t.Errorf("expected ErrPersistenceDisabled, got %v", err)
+	}
+	for _, filePath := range []string{appFile, certFile} {
+		if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+			t.Errorf("expected %s not to be written, got %v", filePath, err)
+		}
+	}
+}
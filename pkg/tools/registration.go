@@ -0,0 +1,95 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	RegistrationStateKeyName     = "state"
+	RegistrationLastErrorKeyName = "lastError"
+
+	RegistrationPending    = "PENDING"
+	RegistrationRegistered = "REGISTERED"
+	RegistrationFailed     = "FAILED"
+)
+
+var ErrRegistrationIdentityMissing = errors.New("registration identity missing")
+
+// RecordRegistrationState merges the registration state and the last registration error into the app file,
+// so that a restarting agent knows whether it has to register again
+func RecordRegistrationState(state string, lastErr string) error {
+	keys, err := registrationStateKeys(state, lastErr)
+	if err != nil {
+		return err
+	}
+	return MergeMapToFile(keys, GetAppFile(), RegistrationStateKeyName)
+}
+
+// DeferRegistrationState is RecordRegistrationState with DeferMergeMapToFile, for the states updated at each
+// registration attempt. The last state is written by Shutdown at the latest.
+func DeferRegistrationState(state string, lastErr string) error {
+	keys, err := registrationStateKeys(state, lastErr)
+	if err != nil {
+		return err
+	}
+	DeferMergeMapToFile(keys, GetAppFile())
+	return nil
+}
+
+func registrationStateKeys(state string, lastErr string) (map[string]string, error) {
+	switch state {
+	case RegistrationPending, RegistrationRegistered, RegistrationFailed:
+	default:
+		return nil, fmt.Errorf("unknown registration state: %s", state)
+	}
+	return map[string]string{
+		RegistrationStateKeyName: state,
+		// the value must stay on one line
+		RegistrationLastErrorKeyName: strings.Join(strings.Fields(lastErr), " "),
+	}, nil
+}
+
+// ReadRegistrationState returns the registration state recorded in the app file
+func ReadRegistrationState() (state, lastErr string, err error) {
+	data, err := readMapFromFile(GetAppFile())
+	if err != nil {
+		return "", "", err
+	}
+	return data[RegistrationStateKeyName], data[RegistrationLastErrorKeyName], nil
+}
+
+// RegistrationFingerprint returns the identity of the agent for the control plane to tell an agent registering
+// again from a new one: the hex sha256 of the app instance of the app file and the in-memory AK, as length
+// prefixed parts. The SK isn't part of it, so it's stable across restarts and key rotations.
+func RegistrationFingerprint() (string, error) {
+	appInstance, _, err := ReadAppInfoFromFile()
+	if err != nil {
+		return "", err
+	}
+	accessKey := GetAccessKey()
+	if appInstance == "" || accessKey == "" {
+		return "", fmt.Errorf("%w: the app instance and the AK must be loaded", ErrRegistrationIdentityMissing)
+	}
+	sum := sha256.Sum256([]byte(partsSigningString([]string{appInstance, accessKey})))
+	return hex.EncodeToString(sum[:]), nil
+}
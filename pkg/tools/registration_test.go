@@ -0,0 +1,102 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegistrationStateRoundTrip(t *testing.T) {
+	setTestFiles(t)
+	if _, err := RecordApplicationToFile("instance", "group", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordRegistrationState(RegistrationFailed, "connect server failed,\ntimeout"); err != nil {
+		t.Fatal(err)
+	}
+	state, lastErr, err := ReadRegistrationState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != RegistrationFailed || lastErr != "connect server failed, timeout" {
+		t.Errorf("unexpected state %s/%s", state, lastErr)
+	}
+
+	if err := RecordRegistrationState(RegistrationRegistered, ""); err != nil {
+		t.Fatal(err)
+	}
+	state, lastErr, err = ReadRegistrationState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != RegistrationRegistered || lastErr != "" {
+		t.Errorf("unexpected state %s/%s", state, lastErr)
+	}
+	instance, group, err := ReadAppInfoFromFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instance != "instance" || group != "group" {
+		t.Errorf("expected app info to be kept, got %s/%s", instance, group)
+	}
+
+	if err := RecordRegistrationState("UNKNOWN", ""); err == nil {
+		t.Errorf("expected error for unknown state")
+	}
+}
+
+func TestRegistrationFingerprint(t *testing.T) {
+	setTestFiles(t)
+	setTestKeys(t, "ak", "sk")
+	if _, err := RegistrationFingerprint(); err == nil {
+		t.Errorf("expected an error without app file")
+	}
+	if _, err := RecordApplicationToFile("instance", "group", true); err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := RegistrationFingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a restart reads the same app file and keys, the group and the SK aren't part of the identity
+	setTestKeys(t, "ak", "rotated-sk")
+	if _, err := RecordApplicationToFile("instance", "other-group", true); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := RegistrationFingerprint(); err != nil || again != fingerprint {
+		t.Errorf("expected a stable fingerprint, got %s, %v", again, err)
+	}
+
+	setTestKeys(t, "other-ak", "sk")
+	if other, _ := RegistrationFingerprint(); other == fingerprint {
+		t.Errorf("expected the fingerprint to change with the AK")
+	}
+	setTestKeys(t, "ak", "sk")
+	if _, err := RecordApplicationToFile("other-instance", "group", true); err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := RegistrationFingerprint(); other == fingerprint {
+		t.Errorf("expected the fingerprint to change with the app instance")
+	}
+
+	setTestKeys(t, "", "")
+	if _, err := RegistrationFingerprint(); !errors.Is(err, ErrRegistrationIdentityMissing) {
+		t.Errorf("expected ErrRegistrationIdentityMissing without AK, got %v", err)
+	}
+}
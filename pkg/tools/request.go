@@ -0,0 +1,86 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// VerifyRequest verifies a signature produced by SignRequest
+func VerifyRequest(sign, method, path string, query url.Values, headers map[string]string, body []byte) bool {
+	return Auth(sign, CanonicalRequest(method, path, query, headers, body))
+}
+
+// CanonicalRequest returns the string signed by SignRequest, it's exposed so that mismatches can be diagnosed
+func CanonicalRequest(method, path string, query url.Values, headers map[string]string, body []byte) string {
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalHeaders, signedHeaders := canonicalRequestHeaders(headers)
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		canonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(query))
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// canonicalRequestHeaders returns the header lines followed by the empty line, and the signed header names.
+// Names differing only by case are merged, their values sorted and joined by a comma.
+func canonicalRequestHeaders(headers map[string]string) (string, string) {
+	merged := make(map[string][]string, len(headers))
+	for name, value := range headers {
+		name = strings.ToLower(strings.TrimSpace(name))
+		merged[name] = append(merged[name], strings.Join(strings.Fields(value), " "))
+	}
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	builder := strings.Builder{}
+	for _, name := range names {
+		values := merged[name]
+		sort.Strings(values)
+		builder.WriteString(name + ":" + strings.Join(values, ",") + "\n")
+	}
+	return builder.String(), strings.Join(names, ";")
+}
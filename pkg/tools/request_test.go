@@ -0,0 +1,60 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestCanonicalRequest(t *testing.T) {
+	query := url.Values{"b": {"2", "1"}, "a": {"x y"}}
+	headers := map[string]string{"Host": "example.com", "Content-Type": " application/json ", "X-Chaos-Ak": "ak"}
+	expected := "POST\n" +
+		"/api/v1/experiments\n" +
+		"a=x+y&b=1&b=2\n" +
+		"content-type:application/json\nhost:example.com\nx-chaos-ak:ak\n\n" +
+		"content-type;host;x-chaos-ak\n" +
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if actual := CanonicalRequest("post", "/api/v1/experiments", query, headers, nil); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestSignRequestStable(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	captureLog(t)
+	body := []byte(`{"name":"cpu"}`)
+	sign := SignRequest("POST", "/experiments",
+		url.Values{"page": {"1"}, "filter": {"b", "a"}},
+		map[string]string{"Host": "example.com", "Content-Type": "application/json"}, body)
+
+	reorderedQuery := url.Values{"filter": {"a", "b"}, "page": {"1"}}
+	reorderedHeaders := map[string]string{"content-type": "application/json", "HOST": "example.com"}
+	if !VerifyRequest(sign, "post", "/experiments", reorderedQuery, reorderedHeaders, body) {
+		t.Errorf("expected reordered query params and headers to verify")
+	}
+	if VerifyRequest(sign, "POST", "/experiments", reorderedQuery, reorderedHeaders, []byte(`{"name":"mem"}`)) {
+		t.Errorf("expected a different body to be rejected")
+	}
+	if VerifyRequest(sign, "POST", "/experiments", url.Values{"page": {"2"}, "filter": {"a", "b"}}, reorderedHeaders, body) {
+		t.Errorf("expected a different query to be rejected")
+	}
+	if VerifyRequest(sign, "POST", "/experiments", reorderedQuery, map[string]string{"Host": "example.com"}, body) {
+		t.Errorf("expected a missing signed header to be rejected")
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"container/list"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// seqScheme is the scheme tag of SignSeq, see partsScheme
+const seqScheme = "seq"
+
+var ErrSequenceNotIncreasing = errors.New("sequence not increasing")
+
+// seqSigningString returns the scheme tag, the sequence number and signData separated by line breaks
+func seqSigningString(scheme, signData string, seq uint64) string {
+	return scheme + "\n" + strconv.FormatUint(seq, 10) + "\n" + signData
+}
+
+// SequenceVerifier verifies the signatures of SignSeq and rejects sequence numbers not greater
+// than the last one accepted for the same AK. It tracks at most capacity AKs, evicting the least
+// recently used one, so an evicted AK starts over.
+type SequenceVerifier struct {
+	lock     sync.Mutex
+	capacity int
+	scheme   string
+	lookup   func(ak string) (string, error)
+	order    *list.List
+	last     map[string]*list.Element
+}
+
+type sequenceEntry struct {
+	ak  string
+	seq uint64
+}
+
+// NewSequenceVerifier returns a verifier resolving the SK of an AK with lookup, or using the
+// in-memory keys if lookup is nil
+func NewSequenceVerifier(capacity int, lookup func(ak string) (string, error)) (*SequenceVerifier, error) {
+	if capacity <= 0 {
+		return nil, errors.New("cap less or equal than 0")
+	}
+	return &SequenceVerifier{
+		capacity: capacity,
+		scheme:   seqScheme,
+		lookup:   lookup,
+		order:    list.New(),
+		last:     make(map[string]*list.Element),
+	}, nil
+}
+
+// Verify checks the signature of the message seq of ak, then that seq is greater than the last accepted one
+func (verifier *SequenceVerifier) Verify(ak, sign, signData string, seq uint64) error {
+	signingString := seqSigningString(verifier.scheme, signData, seq)
+	if verifier.lookup != nil {
+		ok, err := VerifyFor(ak, sign, signingString, verifier.lookup)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrSignMismatch
+		}
+	} else if !Auth(sign, signingString) {
+		return ErrSignMismatch
+	}
+
+	verifier.lock.Lock()
+	defer verifier.lock.Unlock()
+	if element, ok := verifier.last[ak]; ok {
+		entry := element.Value.(*sequenceEntry)
+		if seq <= entry.seq {
+			return ErrSequenceNotIncreasing
+		}
+		entry.seq = seq
+		verifier.order.MoveToBack(element)
+		return nil
+	}
+	verifier.last[ak] = verifier.order.PushBack(&sequenceEntry{ak: ak, seq: seq})
+	if verifier.order.Len() > verifier.capacity {
+		front := verifier.order.Front()
+		verifier.order.Remove(front)
+		delete(verifier.last, front.Value.(*sequenceEntry).ak)
+	}
+	return nil
+}
+
+// Reset forgets the sequence numbers of all AKs
+func (verifier *SequenceVerifier) Reset() {
+	verifier.lock.Lock()
+	defer verifier.lock.Unlock()
+	verifier.order.Init()
+	verifier.last = make(map[string]*list.Element)
+}
+
+// forget forgets the sequence number of ak
+func (verifier *SequenceVerifier) forget(ak string) {
+	verifier.lock.Lock()
+	defer verifier.lock.Unlock()
+	if element, ok := verifier.last[ak]; ok {
+		verifier.order.Remove(element)
+		delete(verifier.last, ak)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSequenceVerifier(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	verifier, err := NewSequenceVerifier(2, lookupTestKeys(map[string]string{"ak": "sk"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// in order
+	for seq := uint64(1); seq <= 3; seq++ {
+		if err := verifier.Verify("ak", SignSeq("data", seq), "data", seq); err != nil {
+			t.Fatalf("expected seq %d to be accepted, got %v", seq, err)
+		}
+	}
+	// replay
+	if err := verifier.Verify("ak", SignSeq("data", 3), "data", 3); !errors.Is(err, ErrSequenceNotIncreasing) {
+		t.Errorf("expected replay to be rejected, got %v", err)
+	}
+	// reorder
+	if err := verifier.Verify("ak", SignSeq("data", 2), "data", 2); !errors.Is(err, ErrSequenceNotIncreasing) {
+		t.Errorf("expected reordered message to be rejected, got %v", err)
+	}
+	// the sequence is bound to the signature
+	if err := verifier.Verify("ak", SignSeq("data", 4), "data", 5); !errors.Is(err, ErrSignMismatch) {
+		t.Errorf("expected signature of another sequence to be rejected, got %v", err)
+	}
+
+	verifier.Reset()
+	if err := verifier.Verify("ak", SignSeq("data", 1), "data", 1); err != nil {
+		t.Errorf("expected sequence to start over after reset, got %v", err)
+	}
+}
+
+func TestSequenceVerifierBounded(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	verifier, err := NewSequenceVerifier(2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ak := range []string{"ak1", "ak2", "ak3"} {
+		if err := verifier.Verify(ak, SignSeq("data", 1), "data", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(verifier.last) != 2 || verifier.order.Len() != 2 {
+		t.Errorf("expected 2 tracked AKs, got %d", len(verifier.last))
+	}
+	if _, ok := verifier.last["ak1"]; ok {
+		t.Errorf("expected the least recently used AK to be evicted")
+	}
+}
+
+func TestSignSeqTagged(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	captureLog(t)
+	if Auth(SignSeq("data", 1), "1\ndata") {
+		t.Errorf("expected a SignSeq signature not to verify as Sign")
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// backgroundGeneration is the set of background tasks stopped together by Shutdown
+type backgroundGeneration struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	tasks  sync.WaitGroup
+}
+
+var (
+	backgroundLock    sync.Mutex
+	currentBackground = newBackgroundGeneration()
+)
+
+func newBackgroundGeneration() *backgroundGeneration {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &backgroundGeneration{ctx: ctx, cancel: cancel}
+}
+
+// startBackground registers a background task stopped by Shutdown, it returns ctx canceled on shutdown too
+// and the function the task calls when it returns
+func startBackground(ctx context.Context) (context.Context, func()) {
+	backgroundLock.Lock()
+	generation := currentBackground
+	generation.tasks.Add(1)
+	backgroundLock.Unlock()
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(generation.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+		generation.tasks.Done()
+	}
+}
+
+// deferredWriter coalesces the merges of DeferMergeMapToFile by file until they're flushed
+type deferredWriter struct {
+	lock    sync.Mutex
+	pending map[string]map[string]string
+	timer   *time.Timer
+}
+
+var (
+	deferredWrites = &deferredWriter{pending: make(map[string]map[string]string)}
+
+	// deferredWriteDelay is the delay before the deferred writes are flushed, replaced in tests
+	deferredWriteDelay = time.Second
+)
+
+// DeferMergeMapToFile is MergeMapToFile delayed by a second, the keys merged into the same file in the
+// meantime are written at once with the last value of each key. Shutdown flushes the pending merges.
+func DeferMergeMapToFile(data map[string]string, filePath string) {
+	deferredWrites.lock.Lock()
+	defer deferredWrites.lock.Unlock()
+	keys, ok := deferredWrites.pending[filePath]
+	if !ok {
+		keys = make(map[string]string, len(data))
+		deferredWrites.pending[filePath] = keys
+	}
+	for key, value := range data {
+		keys[key] = value
+	}
+	if deferredWrites.timer == nil {
+		deferredWrites.timer = time.AfterFunc(deferredWriteDelay, func() {
+			defer PanicPrintStack()
+			if err := FlushDeferredWrites(); err != nil {
+				log.WithError(err).Warningln("flush deferred writes failed")
+			}
+		})
+	}
+}
+
+// FlushDeferredWrites writes the pending merges of DeferMergeMapToFile now. The merges failing are kept
+// pending unless the keys were deferred again meanwhile.
+func FlushDeferredWrites() error {
+	deferredWrites.lock.Lock()
+	pending := deferredWrites.pending
+	deferredWrites.pending = make(map[string]map[string]string)
+	if deferredWrites.timer != nil {
+		deferredWrites.timer.Stop()
+		deferredWrites.timer = nil
+	}
+	deferredWrites.lock.Unlock()
+
+	var errs []error
+	for filePath, keys := range pending {
+		if err := MergeMapToFile(keys, filePath); err != nil {
+			errs = append(errs, err)
+			deferredWrites.lock.Lock()
+			if _, ok := deferredWrites.pending[filePath]; !ok {
+				deferredWrites.pending[filePath] = keys
+			}
+			deferredWrites.lock.Unlock()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Shutdown stops the background tasks of the package, such as PersistPeriodically and RefreshCredentials,
+// flushes the deferred writes, including the registration state, and persists the in-memory keys, so that
+// no update is lost on exit. It returns ctx.Err() if the tasks don't stop before ctx is done.
+func Shutdown(ctx context.Context) error {
+	backgroundLock.Lock()
+	generation := currentBackground
+	currentBackground = newBackgroundGeneration()
+	backgroundLock.Unlock()
+	generation.cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		generation.tasks.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return errors.Join(FlushDeferredWrites(), persistSecretKey())
+}
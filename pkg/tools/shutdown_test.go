@@ -0,0 +1,117 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func setTestDeferredWriteDelay(t *testing.T, delay time.Duration) {
+	t.Helper()
+	previous := deferredWriteDelay
+	deferredWriteDelay = delay
+	t.Cleanup(func() {
+		FlushDeferredWrites()
+		deferredWriteDelay = previous
+	})
+}
+
+func TestShutdownFlushesDeferredWrites(t *testing.T) {
+	appFile, certFile := setTestFiles(t)
+	setTestKeys(t, "", "")
+	setTestDeferredWriteDelay(t, time.Hour)
+	if err := RecordSecretKeyToFile("ak", "sk"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(certFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RecordApplicationToFile("instance", "group", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeferRegistrationState(RegistrationPending, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeferRegistrationState(RegistrationFailed, "connection refused"); err != nil {
+		t.Fatal(err)
+	}
+	DeferMergeMapToFile(map[string]string{"extra": "value"}, appFile)
+	if state, _, _ := ReadRegistrationState(); state != "" {
+		t.Fatalf("expected the writes to be deferred, got state %s", state)
+	}
+
+	PersistPeriodically(context.Background(), time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	state, lastErr, err := ReadRegistrationState()
+	if err != nil || state != RegistrationFailed || lastErr != "connection refused" {
+		t.Errorf("expected the last registration state to be flushed, got %s, %s, %v", state, lastErr, err)
+	}
+	data, err := readMapFromFile(appFile)
+	if err != nil || data["extra"] != "value" || data[AppInstanceKeyName] != "instance" {
+		t.Errorf("expected the deferred merge to be flushed, got %v, %v", data, err)
+	}
+	if data, err := readMapFromFile(certFile); err != nil || data[SecretKeyName] != "sk" {
+		t.Errorf("expected the keys to be persisted, got %v, %v", data, err)
+	}
+}
+
+func TestDeferredWritesFlushAfterDelay(t *testing.T) {
+	setTestFiles(t)
+	setTestDeferredWriteDelay(t, 10*time.Millisecond)
+	if err := DeferRegistrationState(RegistrationRegistered, ""); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if state, _, _ := ReadRegistrationState(); state == RegistrationRegistered {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the deferred write to be flushed after the delay")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestShutdownWaitsForBackgroundTasks(t *testing.T) {
+	setTestKeys(t, "", "")
+	taskCtx, done := startBackground(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to be exceeded by a task not stopping, got %v", err)
+	}
+	if taskCtx.Err() == nil {
+		t.Errorf("expected the context of the task to be canceled")
+	}
+	done()
+
+	// tasks started after a shutdown belong to the next one
+	taskCtx, done = startBackground(context.Background())
+	defer done()
+	if taskCtx.Err() != nil {
+		t.Errorf("expected a task started after shutdown to run")
+	}
+}
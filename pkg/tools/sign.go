@@ -0,0 +1,239 @@
+//go:build !verifyonly
+
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+// The signing side of the package. A server that only verifies signatures, e.g. with VerifyFor or
+// VerifyAuthHeader, builds without it with the verifyonly tag:
+//
+//	go build -tags verifyonly
+//
+// The digest and encoding helpers shared with the verification stay in the other files.
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SignAll returns the signature of signData under the primary and all secondary keys,
+// keyed by KeyFingerprint. It's used to debug rotation issues. It's empty while disabled.
+func SignAll(signData string) map[string]string {
+	signs := make(map[string]string)
+	if credentialsDisabled.Load() {
+		return signs
+	}
+	codec, _ := getSignatureCodec()
+	for _, secretKey := range append([]string{GetSecureKey()}, getSecondarySecretKeys()...) {
+		signs[KeyFingerprint(secretKey)] = signWithKey(signData, secretKey, codec)
+	}
+	return signs
+}
+
+// Sign returns the signature of signData, its length is always SignatureLength(). It's empty if the keys
+// are verify-only, see SignErr. signData is signed as is, without the scheme tag of SignParts and the
+// other schemes, for compatibility with the servers verifying it. A signature of such a scheme is thus
+// accepted by Auth over its signing string, e.g. "parts\n1:a", so signData accepted by Auth must not
+// start with a scheme tag and a line break.
+func Sign(signData string) string {
+	encodeToString, err := SignErr(signData)
+	if err != nil {
+		log.WithError(err).Warningf("Sign refused. ak: %s", GetAccessKey())
+	}
+	return encodeToString
+}
+
+// SignErr is Sign returning ErrOperationNotPermitted instead of an empty signature when the keys are verify-only,
+// or ErrCredentialsDisabled when they're disabled
+func SignErr(signData string) (string, error) {
+	if credentialsDisabled.Load() {
+		return "", ErrCredentialsDisabled
+	}
+	if err := checkSignPermitted(); err != nil {
+		return "", err
+	}
+	start := time.Now()
+	encodeToString := sign(signData)
+	authCounters.signs.Add(1)
+	getLatencyObserver().ObserveSign(time.Since(start))
+	return encodeToString, nil
+}
+
+func sign(signData string) string {
+	secretKey, codec, _ := getSigningState()
+	return signWithKey(signData, secretKey, codec)
+}
+
+// SignTrimmed is Sign over signData without its trailing whitespace. Paired with AuthTrimmed, a client
+// and a server disagreeing on a trailing newline of the body still agree on the signature.
+func SignTrimmed(signData string) string {
+	return Sign(strings.TrimRight(signData, trimmedCutset))
+}
+
+// BuildAuthHeader signs signData with the in-memory keys and formats the auth header, kid may be empty
+func BuildAuthHeader(signData, kid string) (string, error) {
+	if err := checkCredentialsEnabled(); err != nil {
+		return "", err
+	}
+	accessKey := GetAccessKey()
+	if accessKey == "" || GetSecureKey() == "" {
+		return "", errors.New("accessKey or secretKey is empty")
+	}
+	if strings.Contains(accessKey, headerSeparator) || strings.Contains(kid, headerSeparator) {
+		return "", fmt.Errorf("%w: ak and kid can't contain %q", ErrInvalidAuthHeader, headerSeparator)
+	}
+	signature, err := SignErr(signData)
+	if err != nil {
+		return "", err
+	}
+	return AuthHeader{AccessKey: accessKey, KeyID: kid, Signature: signature}.String(), nil
+}
+
+// SignParts signs several logical parts of a request, e.g. method, path and body. Each part is
+// prefixed with its length, so that different splits of the same bytes don't sign the same string.
+// The signing string is tagged by the scheme, so it differs from the other schemes over the same parts.
+func SignParts(parts ...string) string {
+	return Sign(schemeSigningString(partsScheme, parts))
+}
+
+// SignPrehashed signs a body by its hash computed upstream, e.g. from an x-content-sha256 header,
+// instead of hashing the body again. It signs the extra parts followed by the hash like SignParts,
+// under its own scheme tag. The hex hash is compared case-insensitively.
+func SignPrehashed(prehashHex string, extra ...string) string {
+	return Sign(prehashedSigningString(prehashHex, extra))
+}
+
+// SignWithAAD signs signData bound to associated data, e.g. the tenant and the environment, that's
+// authenticated without being part of the payload. The AAD is signed sorted by key, so a signature
+// is only accepted with the same AAD.
+func SignWithAAD(signData string, aad map[string]string) string {
+	return Sign(aadSigningString(signData, aad))
+}
+
+// SignMultipart signs the named fields of a multipart request in the given order, e.g. selected headers
+// and form fields, instead of the raw body with its volatile boundary. Each field is signed as its name
+// and value parts, a named field missing from fields is an error rather than left out.
+func SignMultipart(fields map[string]string, orderedNames []string) (string, error) {
+	signingString, err := multipartSigningString(fields, orderedNames)
+	if err != nil {
+		return "", err
+	}
+	return Sign(signingString), nil
+}
+
+// SignSeq signs signData bound to the sequence number of the message, so that the verifier
+// can detect dropped, replayed or reordered messages
+func SignSeq(signData string, seq uint64) string {
+	return Sign(seqSigningString(seqScheme, signData, seq))
+}
+
+// SignFrame signs a frame of a long-lived connection like a WebSocket, bound to the connection id and
+// the frame counter, so that a frame can't be replayed on the same or another connection. It's signed
+// like SignSeq under its own scheme tag.
+func SignFrame(connID string, counter uint64, payload []byte) string {
+	return Sign(seqSigningString(frameScheme, frameSigningData(connID, payload), counter))
+}
+
+// SignAggregate signs a batch of frames at once, one MAC per batch instead of per frame. The signed data
+// is the concatenation of the length-prefixed frames, so that moving bytes between frames, splitting,
+// merging or reordering them changes the signature.
+func SignAggregate(frames [][]byte) string {
+	return Sign(aggregateSigningData(frames))
+}
+
+// SignRequest signs the canonical form of an HTTP request, in the spirit of AWS SigV4 but with our
+// signing scheme. The canonical request is these lines joined by \n:
+//
+//	the method in uppercase
+//	the path, / if empty
+//	the query with keys sorted, and values sorted per key, escaped by url.QueryEscape as k=v joined by &
+//	a name:value line per header, names lowercased and sorted, values trimmed with inner spaces collapsed
+//	an empty line ending the headers
+//	the lowercased header names sorted and joined by ;
+//	the hex sha256 of the body
+//
+// All the headers passed are signed, so the caller passes the ones it wants signed, e.g. host and
+// content-type. The scheme, host of the URL and fragment aren't part of it.
+func SignRequest(method, path string, query url.Values, headers map[string]string, body []byte) string {
+	return Sign(CanonicalRequest(method, path, query, headers, body))
+}
+
+// SignWithTimestamp embeds the current unix time in milliseconds in front of signData and signs it,
+// the returned timestampedData must be sent along with the signature
+func SignWithTimestamp(signData string) (timestampedData, sign string) {
+	timestampedData = strconv.FormatInt(timeNow().UnixNano()/int64(time.Millisecond), 10) + timestampSeparator + signData
+	return timestampedData, Sign(timestampedData)
+}
+
+// SignClaims returns a compact token carrying claims: base64url(claims json) + "." + base64url(hmac-sha256),
+// the MAC is keyed with the SK so that the peer holding the same SK can verify it.
+func SignClaims(claims map[string]interface{}) (string, error) {
+	if err := checkCredentialsEnabled(); err != nil {
+		return "", err
+	}
+	secretKey := GetSecureKey()
+	if secretKey == "" {
+		return "", errors.New("secretKey is empty")
+	}
+	bytes, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(bytes)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(claimsMAC(payload, secretKey)), nil
+}
+
+// SignDetached signs the payload file at dataPath and writes the signature to sigPath, wrapped every
+// 64 characters so that a long signature doesn't become a single unwieldy line. The payload is bounded
+// by SetMaxSignDataLength.
+func SignDetached(dataPath, sigPath string) error {
+	data, err := readDetachedData(dataPath)
+	if err != nil {
+		return err
+	}
+	signature, err := SignErr(string(data))
+	if err != nil {
+		return err
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	return replaceFile(sigPath, []byte(WrapBase64(signature, detachedSignatureWidth, "\n")+"\n"), 0o644)
+}
+
+// SignHTTPRequest signs req with SignRequest over its method, path, query, signed headers and body, and sets
+// the BuildAuthHeader value to AuthHeaderName. The body is read and rewound, so that req can still be sent.
+func SignHTTPRequest(req *http.Request) error {
+	canonical, err := canonicalHTTPRequest(req)
+	if err != nil {
+		return err
+	}
+	header, err := BuildAuthHeader(canonical, "")
+	if err != nil {
+		return err
+	}
+	req.Header.Set(AuthHeaderName, header)
+	return nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+// credentialSourceKind is what the in-memory keys were loaded from
+type credentialSourceKind int
+
+const (
+	// sourceMemory is keys only set in memory, e.g. by CredentialManager.Set, or no keys
+	sourceMemory credentialSourceKind = iota
+	sourceCertFile
+	sourceKeyring
+	sourceEnv
+	sourceReader
+	sourceProfile
+	sourceProvider
+	sourceDerived
+)
+
+func (kind credentialSourceKind) String() string {
+	switch kind {
+	case sourceCertFile:
+		return "cert file"
+	case sourceKeyring:
+		return "keyring"
+	case sourceEnv:
+		return "environment"
+	case sourceReader:
+		return "reader"
+	case sourceProfile:
+		return "profile"
+	case sourceProvider:
+		return "provider"
+	case sourceDerived:
+		return "derived key"
+	default:
+		return "memory"
+	}
+}
+
+// credentialSource is where the in-memory keys were loaded from, so that only the keys of a cert file
+// are persisted, and only back to that file in its format. Keys injected by the environment, a FIFO,
+// a profile or a provider are kept off the disk. Enable reloads the keys from their source.
+type credentialSource struct {
+	kind credentialSourceKind
+	// certFile and format are the cert file of sourceCertFile keys
+	certFile string
+	format   certFileFormat
+	// reload loads the keys again from the source, nil if it can't be read again, like a FIFO, or
+	// not without a secret that isn't kept, like the KEK of an encrypted cert file
+	reload func() error
+}
+
+func certFileSource(certFile string, format certFileFormat) credentialSource {
+	source := credentialSource{kind: sourceCertFile, certFile: certFile, format: format}
+	switch format {
+	case certFormatText:
+		source.reload = LoadSecretKeyFromFile
+	case certFormatBinary:
+		source.reload = LoadSecretKeyBinary
+	}
+	return source
+}
+
+func (source credentialSource) String() string {
+	if source.kind == sourceCertFile {
+		return source.format.String() + " " + source.kind.String()
+	}
+	return source.kind.String()
+}
+
+// setCredentialsFrom is setCredentials for keys loaded from source
+func setCredentialsFrom(source credentialSource, accessKey, secretKey string) error {
+	return defaultManager.setFrom(source, accessKey, secretKey)
+}
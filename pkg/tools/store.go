@@ -0,0 +1,252 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ErrStoreReadOnly is returned by the Save of a store that can't persist credentials
+var ErrStoreReadOnly = errors.New("credential store is read-only")
+
+// CredentialStore persists and loads the credentials, without touching the in-memory keys
+type CredentialStore interface {
+	Save(creds Credentials) error
+	Load() (Credentials, error)
+}
+
+// FileStore stores the AK and the SK in the cert file
+type FileStore struct{}
+
+func (FileStore) Save(creds Credentials) error {
+	if err := checkSecretStrength(creds.SecretKey); err != nil {
+		return err
+	}
+	if skip, err := skipPersistence(); skip {
+		return err
+	}
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return err
+	}
+	err = writeCredentialFile(map[string]string{
+		AccessKeyName: creds.AccessKey,
+		SecretKeyName: creds.SecretKey,
+	}, certFile)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (FileStore) Load() (Credentials, error) {
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return Credentials{}, err
+	}
+	data, err := readMapFromFile(certFile)
+	if err != nil {
+		return Credentials{}, err
+	}
+	creds := Credentials{AccessKey: data[AccessKeyName], SecretKey: data[SecretKeyName]}
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return Credentials{}, fmt.Errorf("accessKey or secretKey is empty in %s", certFile)
+	}
+	return creds, nil
+}
+
+// Keyring is the secret storage of the OS, like the macOS Keychain, the Windows Credential Manager or
+// libsecret. This package doesn't depend on an implementation, a binary wires one in, e.g. go-keyring.
+type Keyring interface {
+	Set(service, user, secret string) error
+	Get(service, user string) (string, error)
+	Delete(service, user string) error
+}
+
+// KeyringStore stores the SK in the OS keyring under the service and the AK, and only the AK in the
+// cert file, so that the SK isn't kept in a plain file
+type KeyringStore struct {
+	Keyring Keyring
+	Service string
+}
+
+func (store KeyringStore) Save(creds Credentials) error {
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return errors.New("accessKey or secretKey is empty")
+	}
+	if err := checkSecretStrength(creds.SecretKey); err != nil {
+		return err
+	}
+	if skip, err := skipPersistence(); skip {
+		return err
+	}
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return err
+	}
+	if err := store.Keyring.Set(store.Service, creds.AccessKey, creds.SecretKey); err != nil {
+		return fmt.Errorf("store secretKey in the keyring: %w", err)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	keys := keepPrivateKey(map[string]string{AccessKeyName: creds.AccessKey}, certFile)
+	return writeMapToFile(keys, certFile, true, 0o600)
+}
+
+func (store KeyringStore) Load() (Credentials, error) {
+	certFile, err := resolveCertFile()
+	if err != nil {
+		return Credentials{}, err
+	}
+	data, err := readMapFromFile(certFile)
+	if err != nil {
+		return Credentials{}, err
+	}
+	accessKey := data[AccessKeyName]
+	if accessKey == "" {
+		return Credentials{}, fmt.Errorf("accessKey is empty in %s", certFile)
+	}
+	secretKey, err := store.Keyring.Get(store.Service, accessKey)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("load secretKey from the keyring: %w", err)
+	}
+	if secretKey == "" {
+		return Credentials{}, errors.New("secretKey is empty in the keyring")
+	}
+	return Credentials{AccessKey: accessKey, SecretKey: secretKey}, nil
+}
+
+// EnvStore loads the credentials from CHAOS_ACCESS_KEY and CHAOS_SECRET_KEY, it's read-only
+type EnvStore struct{}
+
+func (EnvStore) Save(Credentials) error {
+	return ErrStoreReadOnly
+}
+
+func (EnvStore) Load() (Credentials, error) {
+	creds := Credentials{AccessKey: os.Getenv(AccessKeyEnv), SecretKey: os.Getenv(SecretKeyEnv)}
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return Credentials{}, fmt.Errorf("%s or %s is empty", AccessKeyEnv, SecretKeyEnv)
+	}
+	return creds, nil
+}
+
+// ProviderStore loads the credentials from a CredentialProvider, it's read-only and drops the expiry,
+// RefreshCredentials keeps short-lived credentials fresh instead
+type ProviderStore struct {
+	Provider CredentialProvider
+}
+
+func (ProviderStore) Save(Credentials) error {
+	return ErrStoreReadOnly
+}
+
+func (store ProviderStore) Load() (Credentials, error) {
+	creds, _, err := store.Provider.Retrieve(context.Background())
+	return creds, err
+}
+
+// ChainStore tries its stores in order, e.g. env, keyring, file then a provider
+type ChainStore struct {
+	stores []CredentialStore
+	lock   sync.Mutex
+	source CredentialStore
+}
+
+// NewChainStore returns a store loading from the first of stores yielding credentials and saving
+// to the first writable one
+func NewChainStore(stores ...CredentialStore) *ChainStore {
+	return &ChainStore{stores: stores}
+}
+
+// Load returns the credentials of the first store that yields non-empty ones and remembers it as the
+// source. The errors of all the stores are returned if none succeeds.
+func (chain *ChainStore) Load() (Credentials, error) {
+	var errs []error
+	for _, store := range chain.stores {
+		creds, err := store.Load()
+		if err == nil && (creds.AccessKey == "" || creds.SecretKey == "") {
+			err = errors.New("accessKey or secretKey is empty")
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		chain.lock.Lock()
+		chain.source = store
+		chain.lock.Unlock()
+		return creds, nil
+	}
+	if len(errs) == 0 {
+		return Credentials{}, errors.New("no credential store")
+	}
+	return Credentials{}, errors.Join(errs...)
+}
+
+// Save saves to the first store not returning ErrStoreReadOnly
+func (chain *ChainStore) Save(creds Credentials) error {
+	for _, store := range chain.stores {
+		if err := store.Save(creds); !errors.Is(err, ErrStoreReadOnly) {
+			return err
+		}
+	}
+	return ErrStoreReadOnly
+}
+
+// Source returns the store the last successful Load used, nil if none
+func (chain *ChainStore) Source() CredentialStore {
+	chain.lock.Lock()
+	defer chain.lock.Unlock()
+	return chain.source
+}
+
+// InitCredentials loads the in-memory keys from the first store that succeeds, so that a workstation
+// can prefer a KeyringStore and fall back to the FileStore. The errors of all the stores are returned
+// if none succeeds.
+func InitCredentials(stores ...CredentialStore) error {
+	chain := NewChainStore(stores...)
+	creds, err := chain.Load()
+	if err != nil {
+		return err
+	}
+	source := storeSource(chain.Source())
+	source.reload = func() error {
+		return InitCredentials(stores...)
+	}
+	return setCredentialsFrom(source, creds.AccessKey, creds.SecretKey)
+}
+
+// storeSource returns the source of the keys loaded from store, keys of an unknown store are kept in memory
+func storeSource(store CredentialStore) credentialSource {
+	switch store.(type) {
+	case FileStore:
+		if certFile, err := resolveCertFile(); err == nil {
+			return certFileSource(certFile, certFormatText)
+		}
+	case KeyringStore:
+		return credentialSource{kind: sourceKeyring}
+	case EnvStore:
+		return credentialSource{kind: sourceEnv}
+	case ProviderStore:
+		return credentialSource{kind: sourceProvider}
+	}
+	return credentialSource{}
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChainStore(t *testing.T) {
+	setTestFiles(t)
+	t.Setenv(AccessKeyEnv, "")
+	provider := ProviderStore{Provider: &rotatingProvider{ttl: time.Hour}}
+	chain := NewChainStore(EnvStore{}, FileStore{}, provider)
+
+	creds, err := chain.Load()
+	if err != nil || creds.SecretKey != "sk1" {
+		t.Fatalf("expected the provider to be used, got %+v, %v", creds, err)
+	}
+	if chain.Source() != CredentialStore(provider) {
+		t.Errorf("expected the provider to be reported, got %#v", chain.Source())
+	}
+
+	if err := chain.Save(Credentials{AccessKey: "ak", SecretKey: "file"}); err != nil {
+		t.Fatal(err)
+	}
+	creds, err = chain.Load()
+	if err != nil || creds.SecretKey != "file" {
+		t.Fatalf("expected the file to be saved to and used, got %+v, %v", creds, err)
+	}
+	if chain.Source() != CredentialStore(FileStore{}) {
+		t.Errorf("expected the file to be reported, got %#v", chain.Source())
+	}
+
+	t.Setenv(AccessKeyEnv, "env-ak")
+	t.Setenv(SecretKeyEnv, "env-sk")
+	creds, err = chain.Load()
+	if err != nil || creds.AccessKey != "env-ak" || chain.Source() != CredentialStore(EnvStore{}) {
+		t.Errorf("expected the environment to be preferred, got %+v, %v", creds, err)
+	}
+}
+
+func TestChainStoreReadOnly(t *testing.T) {
+	chain := NewChainStore(EnvStore{})
+	if err := chain.Save(Credentials{AccessKey: "ak", SecretKey: "sk"}); !errors.Is(err, ErrStoreReadOnly) {
+		t.Errorf("expected ErrStoreReadOnly, got %v", err)
+	}
+	if chain.Source() != nil {
+		t.Errorf("expected no source before a load")
+	}
+}
+
+func TestFileStoreReadOnly(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	setTestReadOnly(t, true)
+	if err := (FileStore{}).Save(Credentials{AccessKey: "ak", SecretKey: "sk"}); !errors.Is(err, ErrPersistenceDisabled) {
+		t.Errorf("expected the file store to skip saving, got %v", err)
+	}
+	if IsExist(certFile) {
+		t.Errorf("expected no cert file to be written")
+	}
+}
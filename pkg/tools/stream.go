@@ -0,0 +1,93 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+var ErrFrameTooLarge = errors.New("frame larger than its limit")
+
+// verifyWriter hashes a streamed payload with the keys captured when it was created
+type verifyWriter struct {
+	hash      hash.Hash
+	keyed     bool
+	secretKey string
+	codec     SignatureCodec
+	expected  string
+	limit     int64
+	written   int64
+	err       error
+}
+
+// NewVerifyWriter returns a writer hashing a streamed payload, e.g. a frame of a length-prefixed protocol
+// whose signature comes first, and the function returning whether expectedSign is the signature of Sign
+// over the bytes written. The payload isn't buffered. Writing more than limit bytes, the declared frame
+// length, fails with ErrFrameTooLarge, as does the finalizer; a malformed expectedSign fails the first
+// write without hashing anything.
+func NewVerifyWriter(expectedSign string, limit int64) (io.Writer, func() (bool, error)) {
+	secretKey, codec, fallback := getSigningState()
+	writer := &verifyWriter{secretKey: secretKey, codec: codec, expected: expectedSign, limit: limit}
+	if _, err := codec.Decode(expectedSign); err != nil {
+		if !decodable(expectedSign, codec, fallback) {
+			writer.err = ErrMalformedSignature
+		} else {
+			writer.codec = HexBase64Codec{}
+		}
+	}
+	if hmacSigning.Load() {
+		writer.hash, writer.keyed = hmac.New(getHashSpec().newHash, []byte(secretKey)), true
+	} else {
+		writer.hash = getHashSpec().newHash()
+	}
+	return writer, writer.verify
+}
+
+func (writer *verifyWriter) Write(p []byte) (int, error) {
+	if writer.err != nil {
+		return 0, writer.err
+	}
+	if int64(len(p)) > writer.limit-writer.written {
+		writer.err = fmt.Errorf("%w: more than %d bytes", ErrFrameTooLarge, writer.limit)
+		return 0, writer.err
+	}
+	writer.written += int64(len(p))
+	return writer.hash.Write(p)
+}
+
+func (writer *verifyWriter) verify() (bool, error) {
+	if writer.err == nil && credentialsDisabled.Load() {
+		writer.err = ErrCredentialsDisabled
+	}
+	if writer.err != nil {
+		authCounters.countAuth(false)
+		return false, writer.err
+	}
+	if !writer.keyed {
+		writer.hash.Write([]byte(writer.secretKey))
+	}
+	matched := verifyDigest(writer.expected, writer.hash.Sum(nil), writer.codec)
+	authCounters.countAuth(matched)
+	if !matched {
+		return false, ErrSignMismatch
+	}
+	return true, nil
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestVerifyWriter(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	payload := strings.Repeat("frame payload ", 1000)
+	writer, verify := NewVerifyWriter(Sign(payload), int64(len(payload)))
+	if _, err := io.CopyBuffer(writer, strings.NewReader(payload), make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := verify(); !ok || err != nil {
+		t.Errorf("expected the streamed frame to verify, got %v, %v", ok, err)
+	}
+
+	writer, verify = NewVerifyWriter(Sign(payload), int64(len(payload)))
+	io.WriteString(writer, payload[1:])
+	if ok, err := verify(); ok || !errors.Is(err, ErrSignMismatch) {
+		t.Errorf("expected ErrSignMismatch for an altered frame, got %v, %v", ok, err)
+	}
+
+	SetHMACSigning(true)
+	defer SetHMACSigning(false)
+	writer, verify = NewVerifyWriter(Sign(payload), int64(len(payload)))
+	io.WriteString(writer, payload)
+	if ok, err := verify(); !ok || err != nil {
+		t.Errorf("expected the streamed frame to verify with HMAC signing, got %v, %v", ok, err)
+	}
+}
+
+func TestVerifyWriterOverLimit(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	payload := bytes.Repeat([]byte("x"), 1000)
+	writer, verify := NewVerifyWriter(Sign(string(payload)), 999)
+	if _, err := io.Copy(writer, bytes.NewReader(payload)); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("expected ErrFrameTooLarge while streaming, got %v", err)
+	}
+	if ok, err := verify(); ok || !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("expected the over-limit frame to be rejected, got %v, %v", ok, err)
+	}
+}
+
+func TestVerifyWriterMalformedSignature(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	writer, verify := NewVerifyWriter("not base64!", 10)
+	if _, err := writer.Write([]byte("data")); !errors.Is(err, ErrMalformedSignature) {
+		t.Errorf("expected the first write to fail, got %v", err)
+	}
+	if ok, err := verify(); ok || !errors.Is(err, ErrMalformedSignature) {
+		t.Errorf("expected ErrMalformedSignature, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"unicode"
+)
+
+var (
+	ErrWeakSecret = errors.New("secret key is too weak")
+
+	// minSecretStrength holds the float64 bits of the minimal estimated entropy of a recorded SK,
+	// 0 accepts any SK as before
+	minSecretStrength atomic.Uint64
+)
+
+// SetMinSecretStrength makes every writer and setter of the keys reject SKs whose estimated entropy is
+// below bits with ErrWeakSecret: the Record functions, CommitAll, the stores, the loaders and
+// CredentialManager.Set. 0 disables the check. Zeroing the keys is always allowed.
+func SetMinSecretStrength(bits float64) {
+	minSecretStrength.Store(math.Float64bits(max(bits, 0)))
+}
+
+// checkSecretStrength returns ErrWeakSecret if secretKey is estimated weaker than SetMinSecretStrength
+func checkSecretStrength(secretKey string) error {
+	minBits := math.Float64frombits(minSecretStrength.Load())
+	if minBits == 0 {
+		return nil
+	}
+	if bits := secretStrength(secretKey); bits < minBits {
+		return fmt.Errorf("%w: about %.0f bits, at least %.0f required", ErrWeakSecret, bits, minBits)
+	}
+	return nil
+}
+
+// secretStrength estimates the entropy of secretKey in bits as its length times the log2 of the size of the
+// character classes it uses. Characters repeating or continuing a sequence ("aaaa", "1234") don't count.
+func secretStrength(secretKey string) float64 {
+	var lower, upper, digit, other bool
+	length := 0
+	previous := rune(-1)
+	for _, r := range secretKey {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+		if r != previous && r != previous+1 && r != previous-1 {
+			length++
+		}
+		previous = r
+	}
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if other {
+		pool += 33
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(length) * math.Log2(float64(pool))
+}
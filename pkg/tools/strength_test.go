@@ -0,0 +1,128 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setTestMinSecretStrength(t *testing.T, bits float64) {
+	SetMinSecretStrength(bits)
+	t.Cleanup(func() { SetMinSecretStrength(0) })
+}
+
+func TestMinSecretStrengthWeak(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	setTestMinSecretStrength(t, 80)
+	for _, weak := range []string{"password", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "1234567890123456789", "abcdefghijklmnopqrstuvwxyz"} {
+		if err := RecordSecretKeyToFile("ak", weak); !errors.Is(err, ErrWeakSecret) {
+			t.Errorf("expected %q to be rejected, got %v", weak, err)
+		}
+	}
+	if _, err := os.Stat(certFile); GetSecureKey() != "" || !os.IsNotExist(err) {
+		t.Errorf("expected a weak key to be neither set nor recorded")
+	}
+}
+
+func TestMinSecretStrengthRandom(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	setTestMinSecretStrength(t, 80)
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	strong := base64.RawURLEncoding.EncodeToString(random)
+	if err := RecordSecretKeyToFile("ak", strong); err != nil {
+		t.Fatalf("expected a random key to be accepted, got %v", err)
+	}
+	if GetSecureKey() != strong {
+		t.Errorf("expected the random key to be set")
+	}
+}
+
+func TestMinSecretStrengthDefault(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	if err := RecordSecretKeyToFile("ak", "password"); err != nil {
+		t.Errorf("expected any key to be accepted by default, got %v", err)
+	}
+}
+
+func TestMinSecretStrengthEveryPath(t *testing.T) {
+	setTestKeys(t, "", "")
+	_, certFile := setTestFiles(t)
+	setTestMinSecretStrength(t, 80)
+	weak := Credentials{AccessKey: "ak", SecretKey: "password"}
+	profilesFile := writeTestProfiles(t, map[string]Credentials{"weak": weak})
+	kek := make([]byte, 32)
+	paths := map[string]func() error{
+		"CredentialManager.Set": func() error { return DefaultManager().Set(weak.AccessKey, weak.SecretKey) },
+		"CommitAll": func() error {
+			return CommitAll(weak, AppInfo{AppInstance: "instance", AppGroup: "group"})
+		},
+		"RecordSecretKeyBinary":    func() error { return RecordSecretKeyBinary(weak.AccessKey, weak.SecretKey) },
+		"RecordSecretKeyEncrypted": func() error { return RecordSecretKeyEncrypted(weak.AccessKey, weak.SecretKey, kek) },
+		"FileStore.Save":           func() error { return FileStore{}.Save(weak) },
+		"UseProfile":               func() error { return UseProfile(profilesFile, "weak") },
+		"RefreshCredentials": func() error {
+			return RefreshCredentials(context.Background(), &rotatingProvider{ttl: time.Hour}, time.Minute)
+		},
+		"LoadSecretKeyFromReader": func() error {
+			return LoadSecretKeyFromReader(strings.NewReader("AK=ak\nSK=password\n"))
+		},
+	}
+	for name, path := range paths {
+		t.Run(name, func(t *testing.T) {
+			if err := path(); !errors.Is(err, ErrWeakSecret) {
+				t.Errorf("expected %s to reject a weak key, got %v", name, err)
+			}
+			if GetSecureKey() != "" {
+				t.Errorf("expected %s not to set a weak key", name)
+			}
+			if _, err := os.Stat(certFile); !os.IsNotExist(err) {
+				t.Errorf("expected %s not to write a weak key, got %v", name, err)
+			}
+		})
+	}
+
+	setTestMinSecretStrength(t, 1000)
+	if err := UseDerivedKey("ak", []byte("master"), "salt", "info"); !errors.Is(err, ErrWeakSecret) {
+		t.Errorf("expected UseDerivedKey to be checked, got %v", err)
+	}
+}
+
+func TestMinSecretStrengthLoad(t *testing.T) {
+	setTestKeys(t, "", "")
+	setTestFiles(t)
+	if err := RecordSecretKeyToFile("ak", "password"); err != nil {
+		t.Fatal(err)
+	}
+	setCredentials("", "")
+	setTestMinSecretStrength(t, 80)
+	if err := LoadSecretKeyFromFile(); !errors.Is(err, ErrWeakSecret) || GetSecureKey() != "" {
+		t.Errorf("expected a weak key of the cert file to be rejected, got %v", err)
+	}
+}
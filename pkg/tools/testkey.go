@@ -0,0 +1,41 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import "sync"
+
+// testKeyMutex serializes the WithTestKey closures
+var testKeyMutex sync.Mutex
+
+// WithTestKey runs fn with sk as the in-memory SK, the AK being kept, then restores the previous keys and
+// key policy even if fn panics. It's for the golden tests of downstream packages: the signatures inside fn
+// are deterministic given the codec and the hash. Concurrent calls are serialized, but fn mustn't run
+// concurrently with code setting the keys, and the OnLoaded callbacks aren't notified.
+func WithTestKey(sk string, fn func()) {
+	testKeyMutex.Lock()
+	defer testKeyMutex.Unlock()
+	previous, previousPolicy := defaultManager.Credentials(), defaultManager.Policy()
+	defer func() {
+		defaultManager.credentials.Store(previous)
+		defaultManager.SetPolicy(previousPolicy)
+		authVerifyCache.purge()
+	}()
+	defaultManager.credentials.Store(Credentials{AccessKey: previous.AccessKey, SecretKey: sk})
+	defaultManager.SetPolicy(PolicySignAndVerify)
+	authVerifyCache.purge()
+	fn()
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import "testing"
+
+func TestWithTestKey(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	var sign string
+	WithTestKey("golden", func() {
+		sign = Sign("data")
+	})
+	if sign != signWithKey("data", "golden", HexBase64Codec{}) {
+		t.Errorf("expected the signature under the test key")
+	}
+	if GetAccessKey() != "ak" || GetSecureKey() != "sk" {
+		t.Errorf("expected the keys to be restored")
+	}
+}
+
+func TestWithTestKeyRestoresOnPanic(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	defaultManager.SetPolicy(PolicyVerifyOnly)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected the panic to propagate")
+			}
+		}()
+		WithTestKey("golden", func() {
+			if GetSecureKey() != "golden" || CurrentKeyPolicy() != PolicySignAndVerify {
+				t.Errorf("expected the test key to be usable to sign")
+			}
+			panic("golden test failed")
+		})
+	}()
+	if GetAccessKey() != "ak" || GetSecureKey() != "sk" || CurrentKeyPolicy() != PolicyVerifyOnly {
+		t.Errorf("expected the keys and policy to be restored after a panic")
+	}
+	// the lock was released
+	WithTestKey("golden", func() {})
+}
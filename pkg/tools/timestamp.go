@@ -0,0 +1,115 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const timestampSeparator = "\n"
+
+var (
+	ErrInvalidTimestamp  = errors.New("invalid timestamp")
+	ErrTimestampExpired  = errors.New("timestamp expired")
+	ErrTimestampInFuture = errors.New("timestamp in the future")
+
+	// timeNow is replaced in tests to simulate clock skew
+	timeNow = time.Now
+)
+
+// AuthWithTimestamp verifies a signature of SignWithTimestamp, rejecting timestamps older than maxAge
+// or more than skew in the future, the latter tolerating agents whose clock is ahead of ours
+func AuthWithTimestamp(sign, timestampedData string, maxAge, skew time.Duration) (bool, error) {
+	timestamp, _, err := parseTimestampedData(timestampedData)
+	if err != nil {
+		return false, err
+	}
+	age := timeNow().Sub(timestamp)
+	if age > maxAge {
+		return false, &SkewError{Skew: -age, Err: fmt.Errorf("%w: %s old", ErrTimestampExpired, age)}
+	}
+	if -age > skew {
+		return false, &SkewError{Skew: -age, Err: fmt.Errorf("%w: %s ahead", ErrTimestampInFuture, -age)}
+	}
+	if !Auth(sign, timestampedData) {
+		return false, ErrSignMismatch
+	}
+	return true, nil
+}
+
+func parseTimestampedData(timestampedData string) (time.Time, string, error) {
+	index := strings.Index(timestampedData, timestampSeparator)
+	if index <= 0 {
+		return time.Time{}, "", ErrInvalidTimestamp
+	}
+	millis, err := strconv.ParseInt(timestampedData[:index], 10, 64)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidTimestamp
+	}
+	return time.Unix(0, millis*int64(time.Millisecond)), timestampedData[index+len(timestampSeparator):], nil
+}
+
+// SkewError is a timestamp rejected by AuthWithTimestamp along with the observed skew, the agent timestamp
+// minus the server now, so that the server can echo it back and the agent tell a wrong clock from a delay
+type SkewError struct {
+	Skew time.Duration
+	Err  error
+}
+
+func (e *SkewError) Error() string {
+	return e.Err.Error() + ", " + DescribeSkew(e.Skew)
+}
+
+func (e *SkewError) Unwrap() error {
+	return e.Err
+}
+
+// SkewFromError returns the skew observed by AuthWithTimestamp if err is a SkewError
+func SkewFromError(err error) (time.Duration, bool) {
+	var skewErr *SkewError
+	if errors.As(err, &skewErr) {
+		return skewErr.Skew, true
+	}
+	return 0, false
+}
+
+// DescribeSkew tells an operator how the agent clock differs, e.g. "your clock is 45s behind"
+func DescribeSkew(skew time.Duration) string {
+	switch {
+	case skew < 0:
+		return fmt.Sprintf("your clock is %s behind", (-skew).Round(time.Millisecond))
+	case skew > 0:
+		return fmt.Sprintf("your clock is %s ahead", skew.Round(time.Millisecond))
+	default:
+		return "your clock is in sync"
+	}
+}
+
+// ObservedSkew returns the timestamp embedded in timestampedData by SignWithTimestamp minus the local now,
+// for an agent to diagnose itself: compared with the skew echoed by the server, a difference means the
+// clocks disagree while a similar value means the message was delayed or replayed
+func ObservedSkew(timestampedData string) (time.Duration, error) {
+	timestamp, _, err := parseTimestampedData(timestampedData)
+	if err != nil {
+		return 0, err
+	}
+	return timestamp.Sub(timeNow()), nil
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setTestNow shifts the clock used by the timestamped signatures for the duration of a test
+func setTestNow(t *testing.T, offset time.Duration) {
+	t.Helper()
+	timeNow = func() time.Time {
+		return time.Now().Add(offset)
+	}
+	t.Cleanup(func() {
+		timeNow = time.Now
+	})
+}
+
+func TestAuthWithTimestamp(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	timestampedData, sign := SignWithTimestamp("data")
+	ok, err := AuthWithTimestamp(sign, timestampedData, time.Minute, 0)
+	if err != nil || !ok {
+		t.Errorf("expected fresh signature to verify, got %v, %v", ok, err)
+	}
+
+	setTestNow(t, 2*time.Minute)
+	if _, err := AuthWithTimestamp(sign, timestampedData, time.Minute, 0); !errors.Is(err, ErrTimestampExpired) {
+		t.Errorf("expected ErrTimestampExpired, got %v", err)
+	}
+	if _, err := AuthWithTimestamp(sign, "data", time.Minute, 0); !errors.Is(err, ErrInvalidTimestamp) {
+		t.Errorf("expected ErrInvalidTimestamp, got %v", err)
+	}
+}
+
+func TestAuthWithTimestampSkew(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	// the agent clock is 30s ahead
+	setTestNow(t, 30*time.Second)
+	timestampedData, sign := SignWithTimestamp("data")
+	timeNow = time.Now
+
+	ok, err := AuthWithTimestamp(sign, timestampedData, time.Minute, 60*time.Second)
+	if err != nil || !ok {
+		t.Errorf("expected 30s ahead to be accepted with 60s skew, got %v, %v", ok, err)
+	}
+	if _, err := AuthWithTimestamp(sign, timestampedData, time.Minute, 10*time.Second); !errors.Is(err, ErrTimestampInFuture) {
+		t.Errorf("expected 30s ahead to be rejected with 10s skew, got %v", err)
+	}
+}
+
+func TestAuthWithTimestampReportsSkew(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	setTestNow(t, -45*time.Second)
+	behindData, behindSign := SignWithTimestamp("data")
+	setTestNow(t, 45*time.Second)
+	aheadData, aheadSign := SignWithTimestamp("data")
+	setTestNow(t, 0)
+
+	_, err := AuthWithTimestamp(behindSign, behindData, 30*time.Second, 30*time.Second)
+	skew, ok := SkewFromError(err)
+	if !errors.Is(err, ErrTimestampExpired) || !ok || skew > -45*time.Second+time.Second || skew < -46*time.Second {
+		t.Errorf("expected an expired timestamp with a negative skew, got %v, %v", err, skew)
+	}
+	if !strings.Contains(err.Error(), "behind") {
+		t.Errorf("expected the error to tell the clock is behind, got %v", err)
+	}
+	_, err = AuthWithTimestamp(aheadSign, aheadData, 30*time.Second, 30*time.Second)
+	skew, ok = SkewFromError(err)
+	if !errors.Is(err, ErrTimestampInFuture) || !ok || skew < 44*time.Second || skew > 45*time.Second {
+		t.Errorf("expected a future timestamp with a positive skew, got %v, %v", err, skew)
+	}
+	if _, ok := SkewFromError(ErrSignMismatch); ok {
+		t.Errorf("expected no skew from other errors")
+	}
+}
+
+func TestObservedSkew(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	setTestNow(t, -45*time.Second)
+	timestampedData, _ := SignWithTimestamp("data")
+	setTestNow(t, 0)
+	if skew, err := ObservedSkew(timestampedData); err != nil || skew > -44*time.Second || skew < -46*time.Second {
+		t.Errorf("expected a skew of about -45s, got %v, %v", skew, err)
+	}
+	setTestNow(t, -90*time.Second)
+	if skew, err := ObservedSkew(timestampedData); err != nil || skew < 44*time.Second || skew > 46*time.Second {
+		t.Errorf("expected a skew of about 45s, got %v, %v", skew, err)
+	}
+	if _, err := ObservedSkew("data"); !errors.Is(err, ErrInvalidTimestamp) {
+		t.Errorf("expected ErrInvalidTimestamp, got %v", err)
+	}
+	if DescribeSkew(-45*time.Second) != "your clock is 45s behind" || DescribeSkew(2*time.Second) != "your clock is 2s ahead" {
+		t.Errorf("unexpected skew descriptions %q, %q", DescribeSkew(-45*time.Second), DescribeSkew(2*time.Second))
+	}
+}
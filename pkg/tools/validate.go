@@ -0,0 +1,125 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// IssueCategory classifies the problems found by ValidateCredentialFile
+type IssueCategory string
+
+const (
+	IssueMissingKey         IssueCategory = "missing-key"
+	IssueEmptyValue         IssueCategory = "empty-value"
+	IssueDuplicateKey       IssueCategory = "duplicate-key"
+	IssueUnexpectedKey      IssueCategory = "unexpected-key"
+	IssueMalformedLine      IssueCategory = "malformed-line"
+	IssueForbiddenCharacter IssueCategory = "forbidden-character"
+	IssuePermissions        IssueCategory = "permissions"
+)
+
+// ValidationIssue is one problem of a cert file, it never includes a secret value
+type ValidationIssue struct {
+	Category IssueCategory
+	Key      string
+	Message  string
+}
+
+// ValidationReport lists all the problems found in a cert file
+type ValidationReport struct {
+	Path   string
+	Issues []ValidationIssue
+}
+
+// Valid returns whether no issue was found
+func (report ValidationReport) Valid() bool {
+	return len(report.Issues) == 0
+}
+
+func (report *ValidationReport) add(category IssueCategory, key, format string, args ...interface{}) {
+	report.Issues = append(report.Issues, ValidationIssue{Category: category, Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+// credentialFileKeys are the keys expected in the cert file
+var credentialFileKeys = map[string]bool{
+	AccessKeyName:  true,
+	SecretKeyName:  true,
+	ExpiryKeyName:  true,
+	PolicyKeyName:  true,
+	PrivateKeyName: true,
+}
+
+// ValidateCredentialFile checks the schema of a cert file: AK and SK present and non-empty, no duplicate
+// or unexpected key, no malformed line, values free of whitespace and control characters, and owner only
+// permissions. All the issues are reported, the error is only for a file that can't be read.
+func ValidateCredentialFile(filePath string) (ValidationReport, error) {
+	report := ValidationReport{Path: filePath}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return report, err
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		report.add(IssuePermissions, "", "permissions are %o, expected 600", perm)
+	}
+	seen := make(map[string]bool)
+	lineNumber := 0
+	err = scanFileLines(filePath, func(line string) {
+		lineNumber++
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return
+		}
+		kv := strings.SplitN(line, Delimiter, 2)
+		if len(kv) != 2 {
+			report.add(IssueMalformedLine, "", "line %d isn't key=value", lineNumber)
+			return
+		}
+		key, value := kv[0], kv[1]
+		if seen[key] {
+			report.add(IssueDuplicateKey, key, "%s is duplicated at line %d", key, lineNumber)
+		}
+		seen[key] = true
+		if !credentialFileKeys[key] {
+			report.add(IssueUnexpectedKey, key, "unexpected key %s at line %d", key, lineNumber)
+		}
+		if value == "" {
+			report.add(IssueEmptyValue, key, "%s is empty", key)
+		}
+		if strings.IndexFunc(value, func(r rune) bool {
+			return unicode.IsSpace(r) || unicode.IsControl(r) || r == unicode.ReplacementChar
+		}) >= 0 {
+			report.add(IssueForbiddenCharacter, key, "%s contains whitespace, control or invalid characters", key)
+		} else if key == ExpiryKeyName && value != "" {
+			if _, err := parseExpiry(value); err != nil {
+				report.add(IssueForbiddenCharacter, key, "%s isn't an RFC 3339 time", key)
+			}
+		}
+	})
+	if err != nil {
+		return report, err
+	}
+	for _, key := range []string{AccessKeyName, SecretKeyName} {
+		if !seen[key] {
+			report.add(IssueMissingKey, key, "%s is missing", key)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateCredentialFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		perm     os.FileMode
+		expected []IssueCategory
+	}{
+		{"valid", "AK=ak\nSK=secret\n", 0o600, nil},
+		{"missing key", "AK=ak\n", 0o600, []IssueCategory{IssueMissingKey}},
+		{"empty value", "AK=ak\nSK=\n", 0o600, []IssueCategory{IssueEmptyValue}},
+		{"duplicate key", "AK=ak\nSK=secret\nSK=secret2\n", 0o600, []IssueCategory{IssueDuplicateKey}},
+		{"unexpected key", "AK=ak\nSK=secret\nappGroup=group\n", 0o600, []IssueCategory{IssueUnexpectedKey}},
+		{"malformed line", "AK=ak\nSK=secret\ngarbage\n", 0o600, []IssueCategory{IssueMalformedLine}},
+		{"forbidden character", "AK=ak\nSK=sec ret\x01\n", 0o600, []IssueCategory{IssueForbiddenCharacter}},
+		{"permissions", "AK=ak\nSK=secret\n", 0o644, []IssueCategory{IssuePermissions}},
+		{"several", "SK=secret\nSK=sec ret\n", 0o640, []IssueCategory{IssuePermissions, IssueDuplicateKey, IssueForbiddenCharacter, IssueMissingKey}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), ".chaos.cert")
+			if err := ioutil.WriteFile(filePath, []byte(tt.content), tt.perm); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(filePath, tt.perm); err != nil {
+				t.Fatal(err)
+			}
+			report, err := ValidateCredentialFile(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var categories []IssueCategory
+			for _, issue := range report.Issues {
+				categories = append(categories, issue.Category)
+				if strings.Contains(issue.Message, "secret") || strings.Contains(issue.Message, "sec ret") {
+					t.Errorf("expected the secret not to be reported, got %q", issue.Message)
+				}
+			}
+			if len(categories) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, categories)
+			}
+			for i := range categories {
+				if categories[i] != tt.expected[i] {
+					t.Errorf("expected %v, got %v", tt.expected, categories)
+				}
+			}
+			if report.Valid() != (len(tt.expected) == 0) {
+				t.Errorf("expected Valid to reflect the issues")
+			}
+		})
+	}
+}
+
+func TestValidateCredentialFileMissing(t *testing.T) {
+	if _, err := ValidateCredentialFile(filepath.Join(t.TempDir(), "missing")); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
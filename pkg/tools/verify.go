@@ -0,0 +1,50 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"fmt"
+)
+
+// VerifyFor verifies a signature presented by the agent identified by ak, the SK is resolved by lookup
+// instead of the globally loaded key, so that a server can verify many agents. While SetAKAllowlist is
+// in force, ak must be allowed. A server keying its SKs by kid verifies with VerifyAuthHeader, which
+// checks the AK owning the kid instead.
+func VerifyFor(ak, sign, signData string, lookup func(ak string) (sk string, err error)) (bool, error) {
+	if err := checkAKAllowed(ak); err != nil {
+		return false, err
+	}
+	return verifyFor(ak, sign, signData, lookup)
+}
+
+func verifyFor(ak, sign, signData string, lookup func(ak string) (sk string, err error)) (bool, error) {
+	if err := checkCredentialsEnabled(); err != nil {
+		return false, err
+	}
+	if err := checkSignDataLength(len(signData)); err != nil {
+		return false, err
+	}
+	sk, err := lookup(ak)
+	if err != nil {
+		return false, err
+	}
+	if sk == "" {
+		return false, fmt.Errorf("secretKey of %s is empty", ak)
+	}
+	codec, _ := getSignatureCodec()
+	return verifyWithKey(sign, signData, sk, codec), nil
+}
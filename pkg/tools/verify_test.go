@@ -0,0 +1,86 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var errUnknownAccessKey = errors.New("unknown accessKey")
+
+func lookupTestKeys(keys map[string]string) func(ak string) (string, error) {
+	return func(ak string) (string, error) {
+		sk, ok := keys[ak]
+		if !ok {
+			return "", errUnknownAccessKey
+		}
+		return sk, nil
+	}
+}
+
+// lookupTestOwners is the lookup of VerifyAuthHeader over the AK owning each key id and its SK
+func lookupTestOwners(keys map[string]Credentials) func(id string) (string, string, error) {
+	return func(id string) (string, string, error) {
+		creds, ok := keys[id]
+		if !ok {
+			return "", "", errUnknownAccessKey
+		}
+		return creds.AccessKey, creds.SecretKey, nil
+	}
+}
+
+func TestVerifyFor(t *testing.T) {
+	setTestKeys(t, "agent1", "sk1")
+	sign := Sign("data")
+	lookup := lookupTestKeys(map[string]string{"agent1": "sk1", "agent2": "sk2"})
+
+	ok, err := VerifyFor("agent1", sign, "data", lookup)
+	if err != nil || !ok {
+		t.Errorf("expected signature to verify, got %v, %v", ok, err)
+	}
+
+	ok, err = VerifyFor("agent2", sign, "data", lookup)
+	if err != nil || ok {
+		t.Errorf("expected mismatched SK to be rejected, got %v, %v", ok, err)
+	}
+
+	ok, err = VerifyFor("unknown", sign, "data", lookup)
+	if !errors.Is(err, errUnknownAccessKey) || ok {
+		t.Errorf("expected unknown AK error, got %v, %v", ok, err)
+	}
+}
+
+func TestVerifySignDataTooLarge(t *testing.T) {
+	setTestKeys(t, "agent1", "sk1")
+	SetMaxSignDataLength(16)
+	defer SetMaxSignDataLength(0)
+	signData := strings.Repeat("x", 17)
+	sign := Sign(signData)
+
+	ok, err := VerifyFor("agent1", sign, signData, lookupTestKeys(map[string]string{"agent1": "sk1"}))
+	if !errors.Is(err, ErrSignDataTooLarge) || ok {
+		t.Errorf("expected ErrSignDataTooLarge, got %v, %v", ok, err)
+	}
+	if Auth(sign, signData) {
+		t.Errorf("expected oversized signData to be rejected")
+	}
+	if !Auth(Sign(signData[:16]), signData[:16]) {
+		t.Errorf("expected signData within the limit to verify")
+	}
+}
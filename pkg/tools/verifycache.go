@@ -0,0 +1,110 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// verifyCache remembers recently verified (sign, signData) pairs, so that client retries
+// don't hash the same payload again. Only successful verifications are cached, failures
+// are recomputed and logged every time.
+type verifyCache struct {
+	lock    sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[[sha256.Size]byte]time.Time
+}
+
+var authVerifyCache = &verifyCache{}
+
+// EnableVerifyCache caches up to size successful verifications of Auth for ttl. The cache is
+// cleared whenever the keys or the sign format change. A ttl of 0 disables the cache.
+func EnableVerifyCache(ttl time.Duration, size int) {
+	authVerifyCache.lock.Lock()
+	defer authVerifyCache.lock.Unlock()
+	authVerifyCache.ttl = ttl
+	authVerifyCache.size = size
+	authVerifyCache.entries = make(map[[sha256.Size]byte]time.Time)
+}
+
+func verifyCacheKey(sign string, signData []byte) [sha256.Size]byte {
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, uint64(len(sign)))
+	h.Write([]byte(sign))
+	h.Write(signData)
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+func (cache *verifyCache) enabled() bool {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	return cache.ttl > 0 && cache.size > 0
+}
+
+func (cache *verifyCache) contains(key [sha256.Size]byte) bool {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	expires, ok := cache.entries[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expires) {
+		delete(cache.entries, key)
+		return false
+	}
+	return true
+}
+
+func (cache *verifyCache) add(key [sha256.Size]byte) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if cache.ttl <= 0 || cache.size <= 0 {
+		return
+	}
+	now := time.Now()
+	if len(cache.entries) >= cache.size {
+		for k, expires := range cache.entries {
+			if now.After(expires) {
+				delete(cache.entries, k)
+			}
+		}
+		if len(cache.entries) >= cache.size {
+			cache.entries = make(map[[sha256.Size]byte]time.Time)
+		}
+	}
+	cache.entries[key] = now.Add(cache.ttl)
+}
+
+func (cache *verifyCache) purge() {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if len(cache.entries) > 0 {
+		cache.entries = make(map[[sha256.Size]byte]time.Time)
+	}
+}
+
+func (cache *verifyCache) len() int {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	return len(cache.entries)
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyCacheClearedOnRotation(t *testing.T) {
+	setTestKeys(t, "ak", "sk1")
+	EnableVerifyCache(time.Minute, 16)
+	defer EnableVerifyCache(0, 0)
+
+	sign := Sign("data")
+	if !Auth(sign, "data") || !Auth(sign, "data") {
+		t.Fatalf("expected signature to verify")
+	}
+	if authVerifyCache.len() != 1 {
+		t.Fatalf("expected 1 cached verification, got %d", authVerifyCache.len())
+	}
+
+	setCredentials("ak", "sk2")
+	if authVerifyCache.len() != 0 {
+		t.Errorf("expected rotation to clear the cache")
+	}
+	if Auth(sign, "data") {
+		t.Errorf("expected signature of the old key to be rejected after rotation")
+	}
+}
+
+func TestVerifyCacheExpires(t *testing.T) {
+	setTestKeys(t, "ak", "sk")
+	EnableVerifyCache(time.Millisecond, 16)
+	defer EnableVerifyCache(0, 0)
+
+	key := verifyCacheKey(Sign("data"), []byte("data"))
+	authVerifyCache.add(key)
+	time.Sleep(5 * time.Millisecond)
+	if authVerifyCache.contains(key) {
+		t.Errorf("expected entry to expire")
+	}
+}
+
+func BenchmarkAuth(b *testing.B) {
+	benchmarkAuth(b, 0)
+}
+
+func BenchmarkAuthVerifyCache(b *testing.B) {
+	benchmarkAuth(b, time.Minute)
+}
+
+func benchmarkAuth(b *testing.B, ttl time.Duration) {
+	setCredentials("ak", "sk")
+	EnableVerifyCache(ttl, 16)
+	defer EnableVerifyCache(0, 0)
+	signData := strings.Repeat("x", 4096)
+	sign := Sign(signData)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Auth(sign, signData)
+	}
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright 1999-2020 Alibaba Group Holding Ltd.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tools
+
+import (
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestVerifyOnlyBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the package")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go isn't in the PATH")
+	}
+	output, err := exec.Command(goBin, "list", "-tags", "verifyonly", "-f", "{{.GoFiles}}", ".").CombinedOutput()
+	if err != nil {
+		t.Fatalf("list the verify-only files: %v\n%s", err, output)
+	}
+	if files := strings.Fields(strings.Trim(strings.TrimSpace(string(output)), "[]")); slices.Contains(files, "sign.go") || !slices.Contains(files, "verify.go") {
+		t.Errorf("expected sign.go to be excluded from the verify-only build, got %s", output)
+	}
+	if output, err := exec.Command(goBin, "build", "-tags", "verifyonly", "-o", os.DevNull, ".").CombinedOutput(); err != nil {
+		t.Errorf("expected the verify-only variant to compile: %v\n%s", err, output)
+	}
+}
@@ -41,13 +41,16 @@ func (sh *UpdateApplicationHandler) Handle(request *transport.Request) *transpor
 	if appGroup != "" {
 		options.Opts.ApplicationGroup = appGroup
 	}
-	err := tools.RecordApplicationToFile(options.Opts.ApplicationInstance, options.Opts.ApplicationGroup, true)
+	changes, err := tools.RecordApplicationToFile(options.Opts.ApplicationInstance, options.Opts.ApplicationGroup, true)
 	if err != nil {
 		errMsg := "record application info to local file failed"
 		logrus.WithField(tools.AppInstanceKeyName, options.Opts.ApplicationInstance).
 			WithField(tools.AppGroupKeyName, options.Opts.ApplicationGroup).Warnln(errMsg)
 		return transport.ReturnFail(transport.ServerError, errMsg)
 	}
+	if previous, ok := changes.Previous[tools.AppGroupKeyName]; ok {
+		logrus.Infof("agent moved from group %s to group %s", previous, options.Opts.ApplicationGroup)
+	}
 
 	return transport.ReturnSuccess()
 }